@@ -0,0 +1,209 @@
+package httpc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Auth HTTPリクエストに認証情報を付与するインターフェース
+//
+// Apply はリクエストの試行ごとに、ヘッダー等の設定後(ミドルウェアの適用前)に呼び出されます。
+type Auth interface {
+	Apply(req *http.Request) error
+}
+
+// Challenger 401 Unauthorized のレスポンスに応じて認証情報を更新できるAuth
+//
+// リクエストが401を返した場合、Challenge が呼び出されます。Challenge が真を返すと、
+// 認証情報を付与し直して1度だけリクエストを再送します。
+// resのボディは読み込み済みです。resのWWW-Authenticateヘッダー、および res.Request を参照できます。
+type Challenger interface {
+	Auth
+	Challenge(res *http.Response) (bool, error)
+}
+
+// AuthFunc 関数をAuthとして扱うための型
+type AuthFunc func(req *http.Request) error
+
+func (f AuthFunc) Apply(req *http.Request) error {
+	return f(req)
+}
+
+// BasicAuth Basic認証(RFC 7617)を行うAuthを返す
+//
+// ユーザー名・パスワードのいずれかが空文字列の場合もそのまま送信します。
+func BasicAuth(username, password string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// BearerAuth 固定のBearerトークン(RFC 6750)を付与するAuthを返す
+func BearerAuth(token string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// APIKeyHeader APIキーをヘッダーとして付与するAuthを返す
+func APIKeyHeader(name, key string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set(name, key)
+		return nil
+	})
+}
+
+// APIKeyQuery APIキーをクエリパラメータとして付与するAuthを返す
+//
+// Error に含まれるURLで値が伏字となるのは、api_key, key 等の一般的な名前のパラメータのみです。
+func APIKeyQuery(name, key string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		q := req.URL.Query()
+		q.Set(name, key)
+		req.URL.RawQuery = q.Encode()
+		return nil
+	})
+}
+
+// Token アクセストークン
+type Token struct {
+	AccessToken string
+	// TokenType トークンの種別(空文字列の場合は "Bearer")
+	TokenType string
+	// Expiry 有効期限(ゼロ値の場合は期限なし)
+	Expiry time.Time
+}
+
+// tokenExpiryDelta 有効期限の直前とみなし、トークンを更新する時間
+const tokenExpiryDelta = 10 * time.Second
+
+// Valid トークンが有効期限内であるかを返す
+//
+// 有効期限の10秒前以降は無効とみなします。
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.Expiry)
+}
+
+// authorization Authorizationヘッダーの値を返す
+func (t *Token) authorization() string {
+	typ := t.TokenType
+	if typ == "" || strings.EqualFold(typ, "bearer") {
+		typ = "Bearer"
+	}
+	return typ + " " + t.AccessToken
+}
+
+// TokenSource アクセストークンを取得するインターフェース
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc 関数をTokenSourceとして扱うための型
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// TokenInvalidator トークンの保持・更新を自ら行う TokenSource が実装するインターフェース
+//
+// Invalidate は、サーバーが受け付けなかった(401 Unauthorized を返した)トークンを指定して呼び出されます。
+// 以降の Token の呼び出しでは、そのトークンを返さずに新たなトークンを取得する必要があります。
+// 指定されたトークンが既に更新されている場合は何もしません。
+type TokenInvalidator interface {
+	TokenSource
+	Invalidate(t *Token)
+}
+
+// TokenAuth TokenSource から取得したトークンを付与するAuthを返す
+//
+// TokenSource が TokenInvalidator を実装する場合は、トークンの有効期限の判定を TokenSource に委ね、
+// リクエストごとに TokenSource からトークンを取得します。
+// それ以外の場合は、取得したトークンを有効期限(Token.Valid を参照)まで再利用し、期限が近づくと TokenSource から再取得します。
+// 401 Unauthorized のレスポンスを受け取った場合は、トークンを破棄(TokenInvalidator の場合は Invalidate を呼び出し)して
+// 再取得し、1度だけリクエストを再送します。
+// 返されるAuthは複数のリクエスト・goroutineから共有できます。
+func TokenAuth(src TokenSource) Auth {
+	return &tokenAuth{src: src}
+}
+
+type tokenAuth struct {
+	src TokenSource
+
+	mu    sync.Mutex
+	token *Token
+}
+
+func (a *tokenAuth) Apply(req *http.Request) error {
+	t, err := a.current(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", t.authorization())
+	return nil
+}
+
+func (a *tokenAuth) Challenge(res *http.Response) (bool, error) {
+	if inv, ok := a.src.(TokenInvalidator); ok {
+		if t := parseAuthorization(res.Request.Header.Get("Authorization")); t != nil {
+			inv.Invalidate(t)
+		}
+		return true, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// 他のリクエストにより既に更新されている場合は、そのトークンを使用する
+	if a.token != nil && res.Request.Header.Get("Authorization") == a.token.authorization() {
+		a.token = nil
+	}
+	return true, nil
+}
+
+// current 有効なトークンを返す
+func (a *tokenAuth) current(ctx context.Context) (*Token, error) {
+	if _, ok := a.src.(TokenInvalidator); ok {
+		return a.fetch(ctx)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token.Valid() {
+		return a.token, nil
+	}
+	t, err := a.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.token = t
+	return t, nil
+}
+
+// fetch TokenSource からトークンを取得
+func (a *tokenAuth) fetch(ctx context.Context) (*Token, error) {
+	t, err := a.src.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.AccessToken == "" {
+		return nil, ErrNoToken
+	}
+	return t, nil
+}
+
+// parseAuthorization Authorizationヘッダーの値からトークンを復元
+func parseAuthorization(v string) *Token {
+	typ, token, ok := strings.Cut(v, " ")
+	if !ok || token == "" {
+		return nil
+	}
+	return &Token{AccessToken: token, TokenType: typ}
+}
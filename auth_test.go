@@ -0,0 +1,125 @@
+package httpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+)
+
+// newAuthServer Authorizationヘッダーとクエリパラメータを返すサーバー
+func newAuthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("X-Api-Key") + "|" + r.URL.RawQuery))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestRequest_Auth(t *testing.T) {
+	s := newAuthServer(t)
+
+	tests := []struct {
+		name string
+		auth httpc.Auth
+		want string
+	}{
+		{"basic", httpc.BasicAuth("user", "pass"), "Basic dXNlcjpwYXNz||a=1"},
+		{"basic empty password", httpc.BasicAuth("user", ""), "Basic dXNlcjo=||a=1"},
+		{"bearer", httpc.BearerAuth("token"), "Bearer token||a=1"},
+		{"api key header", httpc.APIKeyHeader("X-API-Key", "secret"), "|secret|a=1"},
+		{"api key query", httpc.APIKeyQuery("api_key", "secret"), "||a=1&api_key=secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := httpc.NewRequest[[]byte]().Auth(tt.auth).Get(context.Background(), s.URL, "a", "1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestRequest_BasicAuth_EmptyPassword(t *testing.T) {
+	s := newAuthServer(t)
+
+	b, err := httpc.NewRequest[[]byte]().BasicAuth("user", "").Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "Basic dXNlcjo=||", string(b))
+}
+
+func TestClient_Auth(t *testing.T) {
+	s := newAuthServer(t)
+
+	c := httpc.NewClient().BaseURL(s.URL).Auth(httpc.BearerAuth("token"))
+	b, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), "/")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token||", string(b))
+}
+
+func TestTokenAuth(t *testing.T) {
+	var fetched atomic.Int32
+	src := httpc.TokenSourceFunc(func(ctx context.Context) (*httpc.Token, error) {
+		n := fetched.Add(1)
+		return &httpc.Token{AccessToken: "t" + strconv.Itoa(int(n)), Expiry: time.Now().Add(time.Hour)}, nil
+	})
+
+	// 2番目以降のトークンのみを受け付けるサーバー
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().Auth(httpc.TokenAuth(src))
+	for range 2 {
+		b, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), s.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer t2", string(b))
+	}
+	assert.Equal(t, int32(2), fetched.Load())
+}
+
+func TestTokenAuth_Expiry(t *testing.T) {
+	var fetched atomic.Int32
+	src := httpc.TokenSourceFunc(func(ctx context.Context) (*httpc.Token, error) {
+		fetched.Add(1)
+		return &httpc.Token{AccessToken: "t", TokenType: "bearer", Expiry: time.Now().Add(5 * time.Second)}, nil
+	})
+	s := newAuthServer(t)
+
+	r := httpc.NewRequest[[]byte]().Auth(httpc.TokenAuth(src))
+	for range 2 {
+		b, err := r.Get(context.Background(), s.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer t||", string(b))
+	}
+	// 有効期限の直前のトークンは再取得する
+	assert.Equal(t, int32(2), fetched.Load())
+}
+
+func TestTokenAuth_Unauthorized(t *testing.T) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer s.Close()
+
+	src := httpc.TokenSourceFunc(func(ctx context.Context) (*httpc.Token, error) {
+		return &httpc.Token{AccessToken: "t"}, nil
+	})
+	_, err := httpc.NewRequest[[]byte]().Auth(httpc.TokenAuth(src)).Get(context.Background(), s.URL)
+	assert.ErrorIs(t, err, httpc.ErrUnauthorized)
+	assert.Equal(t, int32(2), requests.Load())
+}
@@ -0,0 +1,599 @@
+package httpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheStatusName Cache-Statusヘッダー(RFC 9211)におけるキャッシュの名前
+const cacheStatusName = "httpc"
+
+// Cache RFC 9111 に従いレスポンスを保存・再利用するキャッシュ
+//
+// Request.Cache もしくは Client.Cache に指定することで、GETリクエストのレスポンスを CacheStorage に保存し、
+// 新鮮(fresh)な間は接続せずに再利用します。Cache はプライベートキャッシュとして振る舞います。
+//
+//   - 新鮮さはレスポンスの Cache-Control(max-age), Expires, Date, Age ヘッダーから算出し、
+//     明示されない場合は Last-Modified ヘッダーからの経過時間の10%とします(ヒューリスティック)。
+//   - リクエストの Cache-Control(no-cache, no-store, max-age, max-stale, min-fresh, only-if-cached)に従います。
+//   - Vary ヘッダーが指定されたレスポンスは、対応するリクエストヘッダーの値ごとに保存します。
+//   - 新鮮でないレスポンスは ETag, Last-Modified ヘッダーにより条件付きリクエストで再検証し、
+//     304 Not Modified の場合は保存したレスポンスを更新して返します。
+//   - stale-while-revalidate の期間内は保存したレスポンスを返し、バックグラウンドで再検証します。
+//   - stale-if-error の期間内は、接続エラーもしくは5xxのレスポンスの代わりに保存したレスポンスを返します。
+//   - GET, HEAD 以外のメソッドのリクエストが成功した場合は、対象のURIのレスポンスを破棄します。
+//   - Authorizationヘッダーを持つリクエストのレスポンスは、public, s-maxage, must-revalidate のいずれかが
+//     指定された場合のみ保存します(RFC 9111 Section 3.5)。異なる認証情報のクライアント間で Cache を共有しても、
+//     あるクライアントのためのレスポンスが他のクライアントに返されることはありません。
+//
+// 返したレスポンスには Cache-Status ヘッダー(RFC 9211)を付与し、HttpResult.FromCache により
+// キャッシュから返されたかを判別できます。Cache は複数のgoroutineから安全に共有できます。
+type Cache struct {
+	storage CacheStorage
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+
+	now func() time.Time
+}
+
+// NewCache Cacheを生成する関数
+func NewCache(storage CacheStorage) *Cache {
+	return &Cache{
+		storage:      storage,
+		revalidating: map[string]bool{},
+		now:          time.Now,
+	}
+}
+
+// cacheEntry 保存したレスポンス
+type cacheEntry struct {
+	// Vary Varyヘッダーで指定されたリクエストヘッダーの値
+	Vary         map[string]string `json:"vary,omitempty"`
+	StatusCode   int               `json:"status"`
+	Header       http.Header       `json:"header"`
+	Body         []byte            `json:"body"`
+	RequestTime  time.Time         `json:"request_time"`
+	ResponseTime time.Time         `json:"response_time"`
+}
+
+// matches リクエストがVaryヘッダーで指定されたリクエストヘッダーの値に一致するかを返す
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if varyValue(req, name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// age 現在のレスポンスの経過時間(RFC 9111 Section 4.2.3)
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := time.Duration(0)
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		apparentAge = max(0, e.ResponseTime.Sub(date))
+	}
+	ageValue := time.Duration(0)
+	if n, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && n > 0 {
+		ageValue = time.Duration(n) * time.Second
+	}
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	return max(apparentAge, correctedAge) + now.Sub(e.ResponseTime)
+}
+
+// lifetime レスポンスの新鮮さの有効期間(RFC 9111 Section 4.2.1)
+func (e *cacheEntry) lifetime() time.Duration {
+	cc := parseCacheControl(e.Header.Values("Cache-Control"))
+	if d, ok := cc.seconds("max-age"); ok {
+		return d
+	}
+
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.ResponseTime
+	}
+	if v := e.Header.Get("Expires"); v != "" {
+		// 不正な値は既に期限切れであるものとみなす
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return max(0, expires.Sub(date))
+	}
+
+	if heuristicallyCacheable(e.StatusCode) {
+		if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && lastModified.Before(date) {
+			return date.Sub(lastModified) / 10
+		}
+	}
+	return 0
+}
+
+// response 保存したレスポンスから、経過時間をAgeヘッダーに設定したレスポンスを生成
+func (e *cacheEntry) response(req *http.Request, age time.Duration) *http.Response {
+	h := e.Header.Clone()
+	h.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// handler リクエストをキャッシュにより処理するHandlerを返す
+func (c *Cache) handler(next Handler) Handler {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet {
+			res, err := next(req)
+			if err == nil && req.Method != http.MethodHead && res.StatusCode < 400 {
+				c.invalidate(req, res)
+			}
+			return res, err
+		}
+		if bypassCache(req) {
+			return next(req)
+		}
+
+		reqCC := parseCacheControl(req.Header.Values("Cache-Control"))
+		if len(reqCC) == 0 && req.Header.Get("Pragma") == "no-cache" {
+			reqCC["no-cache"] = ""
+		}
+
+		key := cacheKey(req)
+		entries := c.load(key)
+		i := slices.IndexFunc(entries, func(e cacheEntry) bool { return e.matches(req) })
+		if i < 0 {
+			if reqCC.has("only-if-cached") {
+				return gatewayTimeout(req), nil
+			}
+			fwd := "uri-miss"
+			if len(entries) > 0 {
+				fwd = "vary-miss"
+			}
+			return c.fetch(req, next, key, reqCC, fwd)
+		}
+
+		e := entries[i]
+		resCC := parseCacheControl(e.Header.Values("Cache-Control"))
+		age, lifetime := e.age(c.now()), e.lifetime()
+		ttl := lifetime - age
+		if usable(reqCC, resCC, age, lifetime) {
+			return withCacheStatus(e.response(req, age), "hit; ttl=%d", int64(ttl/time.Second)), nil
+		}
+		if reqCC.has("only-if-cached") {
+			return gatewayTimeout(req), nil
+		}
+
+		staleness := -ttl
+		revalidate := reqCC.has("no-cache") || resCC.has("no-cache") || resCC.has("must-revalidate")
+		if swr, ok := resCC.seconds("stale-while-revalidate"); ok && !revalidate && staleness > 0 && staleness <= swr {
+			c.revalidate(req, next, key)
+			return withCacheStatus(e.response(req, age), "hit; ttl=%d", int64(ttl/time.Second)), nil
+		}
+
+		fwd := "stale"
+		if lifetime > age {
+			fwd = "request"
+		}
+		res, err := c.validate(req, next, key, e, reqCC, fwd)
+		if err == nil && res.StatusCode < 500 {
+			return res, nil
+		}
+
+		// stale-if-error(RFC 5861)の期間内であれば、エラーの代わりに保存したレスポンスを返す
+		sie, ok := reqCC.seconds("stale-if-error")
+		if !ok {
+			sie, ok = resCC.seconds("stale-if-error")
+		}
+		if ok && !resCC.has("must-revalidate") && !resCC.has("no-cache") && staleness <= sie {
+			if res != nil && res.Body != nil {
+				_ = res.Body.Close()
+			}
+			return withCacheStatus(e.response(req, age), "hit; ttl=%d; detail=stale-if-error", int64(ttl/time.Second)), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return withCacheStatus(res, "fwd=%s; fwd-status=%d", fwd, res.StatusCode), nil
+	}
+}
+
+// fetch リクエストを送信し、保存できるレスポンスであれば保存する
+func (c *Cache) fetch(req *http.Request, next Handler, key string, reqCC cacheControl, fwd string) (*http.Response, error) {
+	requestTime := c.now()
+	res, err := next(req)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := c.store(req, res, key, reqCC, requestTime)
+	if err != nil {
+		return nil, err
+	}
+	if stored {
+		return withCacheStatus(res, "fwd=%s; stored", fwd), nil
+	}
+	return withCacheStatus(res, "fwd=%s", fwd), nil
+}
+
+// validate 保存したレスポンスのバリデーターにより条件付きリクエストを送信する
+//
+// 304 Not Modified の場合は保存したレスポンスを更新して返します。
+// それ以外のレスポンスは保存できるものであれば保存して返します。
+// 接続エラーおよび5xxのレスポンスは、stale-if-error の判定のためCache-Statusヘッダーを付与せずに返します。
+func (c *Cache) validate(req *http.Request, next Handler, key string, e cacheEntry, reqCC cacheControl, fwd string) (*http.Response, error) {
+	cond := req.Clone(req.Context())
+	if etag := e.Header.Get("ETag"); etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		cond.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := c.now()
+	res, err := next(cond)
+	if err != nil || res.StatusCode >= 500 {
+		return res, err
+	}
+	if res.StatusCode != http.StatusNotModified {
+		stored, err := c.store(req, res, key, reqCC, requestTime)
+		if err != nil {
+			return nil, err
+		}
+		if stored {
+			return withCacheStatus(res, "fwd=%s; fwd-status=%d; stored", fwd, res.StatusCode), nil
+		}
+		return withCacheStatus(res, "fwd=%s; fwd-status=%d", fwd, res.StatusCode), nil
+	}
+	_ = res.Body.Close()
+
+	// RFC 9111 Section 4.3.4: 304レスポンスのヘッダーにより保存したレスポンスを更新する
+	for name, values := range res.Header {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Content-Range", "Transfer-Encoding":
+			continue
+		}
+		e.Header[name] = values
+	}
+	e.RequestTime, e.ResponseTime = requestTime, c.now()
+	c.save(key, req, e)
+	return withCacheStatus(e.response(req, e.age(c.now())), "fwd=%s; fwd-status=%d", fwd, http.StatusNotModified), nil
+}
+
+// revalidate バックグラウンドで再検証する(stale-while-revalidate)
+//
+// 同一のキーに対する再検証が実行中の場合は何もしません。
+func (c *Cache) revalidate(req *http.Request, next Handler, key string) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	// 呼び出し元のリクエストの完了によって再検証が中断されないようにする
+	bg := req.Clone(context.WithoutCancel(req.Context()))
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+		entries := c.load(key)
+		i := slices.IndexFunc(entries, func(e cacheEntry) bool { return e.matches(bg) })
+		if i < 0 {
+			return
+		}
+		res, err := c.validate(bg, next, key, entries[i], cacheControl{}, "stale")
+		if err == nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+	}()
+}
+
+// store 保存できるレスポンスであれば保存する
+//
+// 保存する場合はボディを読み込み、読み込んだ内容で res.Body を置き換えます。
+func (c *Cache) store(req *http.Request, res *http.Response, key string, reqCC cacheControl, requestTime time.Time) (bool, error) {
+	if !storable(req, reqCC, res) {
+		return false, nil
+	}
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := cacheEntry{
+		StatusCode:   res.StatusCode,
+		Header:       res.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: c.now(),
+	}
+	for _, name := range varyNames(res.Header) {
+		if e.Vary == nil {
+			e.Vary = map[string]string{}
+		}
+		e.Vary[name] = varyValue(req, name)
+	}
+	c.save(key, req, e)
+	return true, nil
+}
+
+// load キーに対して保存したレスポンスの一覧を返す
+func (c *Cache) load(key string) []cacheEntry {
+	b, ok := c.storage.Get(key)
+	if !ok {
+		return nil
+	}
+	var entries []cacheEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil
+	}
+	return entries
+}
+
+// save レスポンスを保存する
+//
+// 同じVaryヘッダーの値を持つ既存のレスポンスは置き換えます。
+func (c *Cache) save(key string, req *http.Request, e cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := slices.DeleteFunc(c.load(key), func(old cacheEntry) bool { return old.matches(req) })
+	b, err := json.Marshal(append([]cacheEntry{e}, entries...))
+	if err != nil {
+		return
+	}
+	c.storage.Set(key, b)
+}
+
+// invalidate 安全でないメソッドのリクエストの対象、およびLocation, Content-Locationヘッダーの(同一オリジンの)URIのレスポンスを破棄する
+func (c *Cache) invalidate(req *http.Request, res *http.Response) {
+	c.storage.Delete(cacheKeyURL(req.URL))
+	for _, name := range []string{"Location", "Content-Location"} {
+		v := res.Header.Get(name)
+		if v == "" {
+			continue
+		}
+		u, err := req.URL.Parse(v)
+		if err != nil || u.Scheme != req.URL.Scheme || u.Host != req.URL.Host {
+			continue
+		}
+		c.storage.Delete(cacheKeyURL(u))
+	}
+}
+
+// cacheControl Cache-Controlヘッダーのディレクティブ
+type cacheControl map[string]string
+
+// parseCacheControl Cache-Controlヘッダーの値をディレクティブとして解釈
+//
+// ディレクティブ名は小文字に正規化されます。
+func parseCacheControl(values []string) cacheControl {
+	cc := cacheControl{}
+	s := strings.Join(values, ",")
+	for s = strings.TrimLeft(s, " \t,"); s != ""; s = strings.TrimLeft(s, " \t,") {
+		token, rest := cutToken(s)
+		if token == "" {
+			// 解釈できない文字は読み飛ばす
+			s = s[1:]
+			continue
+		}
+		rest = strings.TrimLeft(rest, " \t")
+		var value string
+		if strings.HasPrefix(rest, "=") {
+			rest = strings.TrimLeft(rest[1:], " \t")
+			if strings.HasPrefix(rest, `"`) {
+				value, rest = cutQuoted(rest)
+			} else {
+				value, rest = cutToken(rest)
+			}
+		}
+		cc[strings.ToLower(token)] = value
+		s = rest
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds 秒数を値とするディレクティブを返す
+//
+// 値が不正な場合は0とみなします。
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, true
+	}
+	if n > math.MaxInt64/int64(time.Second) {
+		n = math.MaxInt64 / int64(time.Second)
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// usable 保存したレスポンスを再検証せずに返せるかを返す(RFC 9111 Section 4.2)
+func usable(reqCC, resCC cacheControl, age, lifetime time.Duration) bool {
+	if reqCC.has("no-cache") || resCC.has("no-cache") {
+		return false
+	}
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && lifetime-age < minFresh {
+		return false
+	}
+	if lifetime > age {
+		return true
+	}
+
+	// max-stale の範囲内であれば新鮮でないレスポンスを許容する
+	if resCC.has("must-revalidate") {
+		return false
+	}
+	if v, ok := reqCC["max-stale"]; ok {
+		if v == "" {
+			return true
+		}
+		maxStale, _ := reqCC.seconds("max-stale")
+		return age-lifetime <= maxStale
+	}
+	return false
+}
+
+// storable レスポンスを保存できるかを返す(RFC 9111 Section 3)
+func storable(req *http.Request, reqCC cacheControl, res *http.Response) bool {
+	if reqCC.has("no-store") {
+		return false
+	}
+	resCC := parseCacheControl(res.Header.Values("Cache-Control"))
+	if resCC.has("no-store") || slices.Contains(varyNames(res.Header), "*") {
+		return false
+	}
+	// 認証を伴うリクエストのレスポンスは、共有を明示的に許可された場合のみ保存する(RFC 9111 Section 3.5)
+	if req.Header.Get("Authorization") != "" &&
+		!resCC.has("public") && !resCC.has("s-maxage") && !resCC.has("must-revalidate") {
+		return false
+	}
+	if res.StatusCode < 200 || res.StatusCode == http.StatusPartialContent || res.StatusCode == http.StatusNotModified {
+		return false
+	}
+	return heuristicallyCacheable(res.StatusCode) ||
+		resCC.has("max-age") || resCC.has("public") || resCC.has("private") ||
+		res.Header.Get("Expires") != ""
+}
+
+// heuristicallyCacheable ヒューリスティックに新鮮さを算出できるステータスコードであるかを返す(RFC 9110 Section 15.1)
+func heuristicallyCacheable(code int) bool {
+	switch code {
+	case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+// bypassCache キャッシュを使用せずに送信するリクエストであるかを返す
+//
+// 呼び出し元による条件付きリクエストおよび範囲リクエストはそのまま送信します。
+func bypassCache(req *http.Request) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// varyNames Varyヘッダーで指定されたヘッダー名(正規化済み)の一覧を返す
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// varyValue Varyヘッダーで指定されたリクエストヘッダーの値を正規化して返す
+func varyValue(req *http.Request, name string) string {
+	values := req.Header.Values(name)
+	// Header.Values はヘッダー自身のスライスを返すため、複製して正規化する
+	normalized := make([]string, len(values))
+	for i, v := range values {
+		normalized[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(normalized, ", ")
+}
+
+// cacheKey リクエストに対するキャッシュのキーを返す
+func cacheKey(req *http.Request) string {
+	return cacheKeyURL(req.URL)
+}
+
+func cacheKeyURL(u *url.URL) string {
+	uu := *u
+	uu.Fragment = ""
+	uu.RawFragment = ""
+	return http.MethodGet + " " + uu.String()
+}
+
+// gatewayTimeout only-if-cached ディレクティブに対して保存したレスポンスがない場合の 504 Gateway Timeout レスポンスを生成
+func gatewayTimeout(req *http.Request) *http.Response {
+	res := &http.Response{
+		Status:     "504 " + http.StatusText(http.StatusGatewayTimeout),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+	return withCacheStatus(res, "detail=only-if-cached")
+}
+
+// withCacheStatus レスポンスにCache-Statusヘッダーを付与する
+//
+// 保存したレスポンス等とヘッダーを共有しないよう、複製したヘッダーに付与します。
+func withCacheStatus(res *http.Response, format string, args ...any) *http.Response {
+	h := res.Header.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	h.Add("Cache-Status", cacheStatusName+"; "+fmt.Sprintf(format, args...))
+	res.Header = h
+	return res
+}
+
+// fromCache Cache-Statusヘッダーからレスポンスがキャッシュから返されたかを判別する
+//
+// 最後のメンバー(クライアントに最も近いキャッシュ)が Cache のものであり、hit パラメータもしくは
+// 304による再検証を表す fwd-status=304 パラメータを含む場合にtrueを返します。
+func fromCache(h http.Header) bool {
+	values := h.Values("Cache-Status")
+	if len(values) == 0 {
+		return false
+	}
+	members := strings.Split(values[len(values)-1], ",")
+	params := strings.Split(members[len(members)-1], ";")
+	if strings.TrimSpace(params[0]) != cacheStatusName {
+		return false
+	}
+	for _, p := range params[1:] {
+		switch strings.TrimSpace(p) {
+		case "hit", "fwd-status=304":
+			return true
+		}
+	}
+	return false
+}
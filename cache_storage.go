@@ -0,0 +1,155 @@
+package httpc
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStorage Cache がレスポンスを保存する先
+//
+// キーはリクエストのURIから生成した文字列、値は保存したレスポンスを直列化したバイト列です。
+// 実装は複数のgoroutineから安全に呼び出せる必要があります。
+// キャッシュは最善努力であるため、保存・削除に失敗した場合もエラーを返しません。
+type CacheStorage interface {
+	// Get キーに対する値を返す
+	Get(key string) ([]byte, bool)
+	// Set キーに対する値を保存
+	Set(key string, value []byte)
+	// Delete キーに対する値を削除
+	Delete(key string)
+}
+
+// MemoryCacheStorage メモリ上のLRUキャッシュによる CacheStorage
+//
+// 保存した値(およびキー)の合計のバイト数が上限を超えた場合は、最も長く参照されていない値から破棄します。
+// 上限を超える大きさの値は保存しません。
+type MemoryCacheStorage struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCacheStorage MemoryCacheStorageを生成する関数
+//
+// maxBytesには保存する値の合計のバイト数の上限を指定します。
+func NewMemoryCacheStorage(maxBytes int64) *MemoryCacheStorage {
+	return &MemoryCacheStorage{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryCacheStorage) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).value, true
+}
+
+func (s *MemoryCacheStorage) Set(key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	n := int64(len(key) + len(value))
+	if n > s.maxBytes {
+		return
+	}
+	s.items[key] = s.ll.PushFront(&memoryCacheItem{key: key, value: value})
+	s.size += n
+	for s.size > s.maxBytes {
+		s.remove(s.ll.Back().Value.(*memoryCacheItem).key)
+	}
+}
+
+func (s *MemoryCacheStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+// Size 保存した値(およびキー)の合計のバイト数を返す
+func (s *MemoryCacheStorage) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *MemoryCacheStorage) remove(key string) {
+	el, ok := s.items[key]
+	if !ok {
+		return
+	}
+	item := s.ll.Remove(el).(*memoryCacheItem)
+	delete(s.items, key)
+	s.size -= int64(len(item.key) + len(item.value))
+}
+
+// DirCacheStorage ディレクトリ上のファイルによる CacheStorage
+//
+// キーのSHA-256ハッシュをファイル名として、値を1つのファイルに保存します。
+// 一時ファイルに書き出した後に置き換えるため、複数のプロセスから同じディレクトリを共有できます。
+// 保存する値の合計の大きさは制限しません。
+type DirCacheStorage struct {
+	dir string
+}
+
+// NewDirCacheStorage DirCacheStorageを生成する関数
+//
+// ディレクトリは最初の保存時に(存在しなければ)作成します。
+func NewDirCacheStorage(dir string) *DirCacheStorage {
+	return &DirCacheStorage{dir: dir}
+}
+
+func (s *DirCacheStorage) Get(key string) ([]byte, bool) {
+	b, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+func (s *DirCacheStorage) Set(key string, value []byte) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	_ = os.Rename(f.Name(), s.path(key))
+}
+
+func (s *DirCacheStorage) Delete(key string) {
+	_ = os.Remove(s.path(key))
+}
+
+// path キーに対するファイルのパスを返す
+func (s *DirCacheStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,294 @@
+package httpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+)
+
+// getCached GETリクエストを送信し、ボディとキャッシュから返されたかを返す
+func getCached(t *testing.T, c *httpc.Client, u string, headers ...string) (string, bool, error) {
+	t.Helper()
+	r := httpc.NewRequestFrom[[]byte](c).Header("Accept", "text/plain")
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header(headers[i], headers[i+1])
+	}
+	result, err := r.TryGet(context.Background(), u)
+	if err != nil {
+		return "", false, err
+	}
+	var b []byte
+	assert.NoError(t, result.As(&b))
+	return string(b), result.(*httpc.HttpResult[[]byte]).FromCache(), nil
+}
+
+func TestCache_Fresh(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().Cache(httpc.NewCache(httpc.NewMemoryCacheStorage(1 << 20)))
+
+	body, cached, err := getCached(t, c, s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", body)
+	assert.False(t, cached)
+
+	body, cached, err = getCached(t, c, s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", body)
+	assert.True(t, cached)
+	assert.Equal(t, int32(1), hits.Load())
+
+	// リクエストの no-cache は再検証(バリデーターがなければ再取得)を要求する
+	_, cached, err = getCached(t, c, s.URL, "Cache-Control", "no-cache")
+	assert.NoError(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, int32(2), hits.Load())
+
+	// 安全でないメソッドのリクエストが成功した場合は破棄する
+	_, err = httpc.NewRequestFrom[[]byte](c).Header("Accept", "text/plain").TryDelete(context.Background(), s.URL)
+	assert.NoError(t, err)
+	_, cached, err = getCached(t, c, s.URL)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, int32(4), hits.Load())
+}
+
+func TestCache_Revalidate(t *testing.T) {
+	var hits, notModified atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("v1 body"))
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().Cache(httpc.NewCache(httpc.NewMemoryCacheStorage(1 << 20)))
+	for i := range 3 {
+		body, cached, err := getCached(t, c, s.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1 body", body)
+		assert.Equal(t, i > 0, cached)
+	}
+	assert.Equal(t, int32(3), hits.Load())
+	assert.Equal(t, int32(2), notModified.Load())
+}
+
+func TestCache_Vary(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte("lang=" + r.Header.Get("Accept-Language")))
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().Cache(httpc.NewCache(httpc.NewMemoryCacheStorage(1 << 20)))
+	for _, tt := range []struct {
+		lang   string
+		cached bool
+	}{
+		{"ja", false},
+		{"en", false},
+		{"ja", true},
+		{"en", true},
+	} {
+		body, cached, err := getCached(t, c, s.URL, "Accept-Language", tt.lang)
+		assert.NoError(t, err)
+		assert.Equal(t, "lang="+tt.lang, body)
+		assert.Equal(t, tt.cached, cached, tt.lang)
+	}
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestCache_NoStore(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "no-store, max-age=60")
+		_, _ = w.Write([]byte("secret"))
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().Cache(httpc.NewCache(httpc.NewMemoryCacheStorage(1 << 20)))
+	for range 2 {
+		_, cached, err := getCached(t, c, s.URL)
+		assert.NoError(t, err)
+		assert.False(t, cached)
+	}
+	assert.Equal(t, int32(2), hits.Load())
+
+	// 保存したレスポンスがない場合、only-if-cached には 504 を返す
+	_, _, err := getCached(t, c, s.URL, "Cache-Control", "only-if-cached")
+	var e *httpc.Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusGatewayTimeout, e.StatusCode())
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestCache_Authorization(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer s.Close()
+
+	// 異なる認証情報のクライアントで同じ Cache を共有する
+	cache := httpc.NewCache(httpc.NewMemoryCacheStorage(1 << 20))
+	alice := httpc.NewClient().Auth(httpc.BearerAuth("alice")).Cache(cache)
+	bob := httpc.NewClient().Auth(httpc.BearerAuth("bob")).Cache(cache)
+
+	// 認証を伴うリクエストのレスポンスは保存しない
+	body, cached, err := getCached(t, alice, s.URL+"?cc=max-age%3D60")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer alice", body)
+	assert.False(t, cached)
+	body, cached, err = getCached(t, bob, s.URL+"?cc=max-age%3D60")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer bob", body)
+	assert.False(t, cached)
+	assert.Equal(t, int32(2), hits.Load())
+
+	// public が指定されたレスポンスは共有できる
+	_, cached, err = getCached(t, alice, s.URL+"?cc=public,max-age%3D60")
+	assert.NoError(t, err)
+	assert.False(t, cached)
+	body, cached, err = getCached(t, bob, s.URL+"?cc=public,max-age%3D60")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer alice", body)
+	assert.True(t, cached)
+	assert.Equal(t, int32(3), hits.Load())
+}
+
+func TestCache_StaleIfError(t *testing.T) {
+	var fail atomic.Bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// 受け取った時点で新鮮でないレスポンス
+		w.Header().Set("Cache-Control", "max-age=60, stale-if-error=600")
+		w.Header().Set("Age", "120")
+		_, _ = w.Write([]byte("last known"))
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().Cache(httpc.NewCache(httpc.NewMemoryCacheStorage(1 << 20)))
+	_, cached, err := getCached(t, c, s.URL)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	fail.Store(true)
+	body, cached, err := getCached(t, c, s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "last known", body)
+	assert.True(t, cached)
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=600")
+		if n == 1 {
+			w.Header().Set("Age", "120")
+		}
+		_, _ = w.Write([]byte("version " + string(rune('0'+n))))
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().Cache(httpc.NewCache(httpc.NewMemoryCacheStorage(1 << 20)))
+	body, _, err := getCached(t, c, s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "version 1", body)
+
+	// 新鮮でないレスポンスを返し、バックグラウンドで再検証する
+	body, cached, err := getCached(t, c, s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "version 1", body)
+	assert.True(t, cached)
+	assert.Eventually(t, func() bool {
+		body, _, _ := getCached(t, c, s.URL)
+		return body == "version 2"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestMemoryCacheStorage(t *testing.T) {
+	s := httpc.NewMemoryCacheStorage(10)
+	s.Set("a", []byte("1234"))
+	s.Set("b", []byte("1234"))
+	assert.Equal(t, int64(10), s.Size())
+
+	// 参照したものは破棄の対象から外れる
+	_, ok := s.Get("a")
+	assert.True(t, ok)
+	s.Set("c", []byte("12"))
+	_, ok = s.Get("b")
+	assert.False(t, ok)
+	v, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1234", string(v))
+
+	// 上限を超える値は保存しない
+	s.Set("d", []byte("0123456789"))
+	_, ok = s.Get("d")
+	assert.False(t, ok)
+
+	s.Delete("a")
+	s.Delete("c")
+	assert.Equal(t, int64(0), s.Size())
+}
+
+func TestDirCacheStorage(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("persisted"))
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+	_, _, err := getCached(t, httpc.NewClient().Cache(httpc.NewCache(httpc.NewDirCacheStorage(dir))), s.URL)
+	assert.NoError(t, err)
+
+	// 別のCacheからも同じディレクトリの保存内容を参照できる
+	body, cached, err := getCached(t, httpc.NewClient().Cache(httpc.NewCache(httpc.NewDirCacheStorage(dir))), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "persisted", body)
+	assert.True(t, cached)
+	assert.Equal(t, int32(1), hits.Load())
+
+	storage := httpc.NewDirCacheStorage(dir)
+	storage.Set("key", []byte("value"))
+	v, ok := storage.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "value", string(v))
+	storage.Delete("key")
+	_, ok = storage.Get("key")
+	assert.False(t, ok)
+}
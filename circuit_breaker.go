@@ -0,0 +1,336 @@
+package httpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState サーキットブレーカーの状態
+type CircuitState int
+
+const (
+	// CircuitClosed リクエストを通常どおり送信する状態
+	CircuitClosed CircuitState = iota
+	// CircuitOpen リクエストを送信せずに ErrCircuitOpen を返す状態
+	CircuitOpen
+	// CircuitHalfOpen 限られた数の試験的なリクエストにより回復を確認する状態
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitOpenError サーキットブレーカーによりリクエストが遮断されたことを表すエラー
+//
+// errors.Is(err, ErrCircuitOpen) で判定できます。
+type CircuitOpenError struct {
+	key string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "circuit breaker is open: " + e.key
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Key 遮断したサーキットのキーを返す
+func (e *CircuitOpenError) Key() string {
+	return e.key
+}
+
+// circuitBuckets 失敗率の集計に用いる時間窓の分割数
+const circuitBuckets = 10
+
+// CircuitBreaker キー(既定ではホスト)ごとのサーキットブレーカー
+//
+// 各サーキットは以下のように状態を遷移します。
+//   - Closed: 直近の時間窓におけるリクエスト数が MinRequests 以上、かつ失敗率が FailureRatio 以上となった場合に Open へ遷移
+//   - Open: Cooldown の経過後に HalfOpen へ遷移。それまでのリクエストは送信せずに *CircuitOpenError を返す
+//   - HalfOpen: Probes で指定した数のリクエストのみを送信し、すべて成功すれば Closed へ、いずれかが失敗すれば Open へ遷移
+//
+// 既定ではネットワークエラーおよびステータスコード5xxのレスポンスを失敗とみなします。
+// キャンセルされたリクエストは成功・失敗のいずれにも数えません。
+// CircuitBreaker は複数のリクエスト・goroutineから共有できます。
+type CircuitBreaker struct {
+	window        time.Duration
+	minRequests   int
+	failureRatio  float64
+	cooldown      time.Duration
+	probes        int
+	keyFunc       func(*http.Request) string
+	failureIf     func(*http.Response, error) bool
+	onStateChange func(key string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit キーごとのサーキットの状態
+type circuit struct {
+	state      CircuitState
+	generation uint64
+	openedAt   time.Time
+
+	buckets [circuitBuckets]circuitBucket
+
+	probesInFlight int
+	probeSuccesses int
+}
+
+// circuitBucket 時間窓を分割した区間ごとの集計
+type circuitBucket struct {
+	index    int64
+	total    int
+	failures int
+}
+
+// NewCircuitBreaker CircuitBreakerを生成する関数
+//
+// 既定値は時間窓60秒、最小リクエスト数10、失敗率0.5、Cooldown 30秒、Probes 1 です。
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		window:       time.Minute,
+		minRequests:  10,
+		failureRatio: 0.5,
+		cooldown:     30 * time.Second,
+		probes:       1,
+		circuits:     map[string]*circuit{},
+	}
+}
+
+// Window 失敗率を集計する時間窓を設定
+func (cb *CircuitBreaker) Window(d time.Duration) *CircuitBreaker {
+	cb.window = d
+	return cb
+}
+
+// MinRequests 失敗率を評価するために必要な時間窓内の最小リクエスト数を設定
+func (cb *CircuitBreaker) MinRequests(n int) *CircuitBreaker {
+	cb.minRequests = n
+	return cb
+}
+
+// FailureRatio Open へ遷移する失敗率(0から1)を設定
+func (cb *CircuitBreaker) FailureRatio(ratio float64) *CircuitBreaker {
+	cb.failureRatio = ratio
+	return cb
+}
+
+// Cooldown Open から HalfOpen へ遷移するまでの時間を設定
+func (cb *CircuitBreaker) Cooldown(d time.Duration) *CircuitBreaker {
+	cb.cooldown = d
+	return cb
+}
+
+// Probes HalfOpen において送信する試験的なリクエストの数を設定
+func (cb *CircuitBreaker) Probes(n int) *CircuitBreaker {
+	cb.probes = n
+	return cb
+}
+
+// KeyFunc サーキットを識別するキーを決定する関数を設定
+//
+// 既定ではリクエストURLのホスト(ポートを含む)をキーとします。
+func (cb *CircuitBreaker) KeyFunc(f func(*http.Request) string) *CircuitBreaker {
+	cb.keyFunc = f
+	return cb
+}
+
+// FailureIf リクエストの失敗を判定する関数を設定
+//
+// resはネットワークエラーの場合nil、errはレスポンスを受け取った場合nilとなります。
+func (cb *CircuitBreaker) FailureIf(f func(res *http.Response, err error) bool) *CircuitBreaker {
+	cb.failureIf = f
+	return cb
+}
+
+// OnStateChange 状態の遷移時に呼び出される関数を設定
+//
+// メトリクスの記録等に使用できます。関数はロックの外で同期的に呼び出されます。
+func (cb *CircuitBreaker) OnStateChange(f func(key string, from, to CircuitState)) *CircuitBreaker {
+	cb.onStateChange = f
+	return cb
+}
+
+// State キーに対応するサーキットの現在の状態を返す
+func (cb *CircuitBreaker) State(key string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.circuits[key]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= cb.cooldown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// key リクエストに対応するサーキットのキーを返す
+func (cb *CircuitBreaker) key(req *http.Request) string {
+	if cb.keyFunc != nil {
+		return cb.keyFunc(req)
+	}
+	return req.URL.Host
+}
+
+// allow リクエストの送信可否を判定
+//
+// 送信可能な場合は、結果を記録する関数を返します。送信不可の場合は *CircuitOpenError を返します。
+func (cb *CircuitBreaker) allow(req *http.Request) (func(*http.Response, error), error) {
+	key := cb.key(req)
+
+	cb.mu.Lock()
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[key] = c
+	}
+
+	from := c.state
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= cb.cooldown {
+		c.transition(CircuitHalfOpen)
+	}
+
+	allowed := true
+	if c.state == CircuitOpen || (c.state == CircuitHalfOpen && c.probesInFlight+c.probeSuccesses >= max(cb.probes, 1)) {
+		allowed = false
+	} else if c.state == CircuitHalfOpen {
+		c.probesInFlight++
+	}
+	generation, to := c.generation, c.state
+	cb.mu.Unlock()
+
+	cb.notify(key, from, to)
+	if !allowed {
+		return nil, &CircuitOpenError{key: key}
+	}
+	return func(res *http.Response, err error) {
+		cb.record(key, generation, cb.outcome(res, err))
+	}, nil
+}
+
+// circuitOutcome サーキットに記録するリクエストの結果
+type circuitOutcome int
+
+const (
+	circuitSuccess circuitOutcome = iota
+	circuitFailure
+	// circuitCanceled 成功・失敗のいずれにも数えない結果(キャンセル)
+	circuitCanceled
+)
+
+// outcome リクエストの結果を判定
+//
+// キャンセルされたリクエストは接続先の状態を表さないため、FailureIf の設定に関わらず記録の対象外とします。
+func (cb *CircuitBreaker) outcome(res *http.Response, err error) circuitOutcome {
+	if err != nil && errors.Is(err, context.Canceled) {
+		return circuitCanceled
+	}
+	var failed bool
+	if cb.failureIf != nil {
+		failed = cb.failureIf(res, err)
+	} else {
+		failed = err != nil || res.StatusCode >= 500
+	}
+	if failed {
+		return circuitFailure
+	}
+	return circuitSuccess
+}
+
+// record リクエストの結果を記録し、必要に応じて状態を遷移
+//
+// 記録の対象となるのは、送信時と同じ世代(状態の遷移ごとに更新)の結果のみです。
+// キャンセルされた試験的なリクエストは、結果を記録せずに枠のみを解放します。
+func (cb *CircuitBreaker) record(key string, generation uint64, outcome circuitOutcome) {
+	cb.mu.Lock()
+	c := cb.circuits[key]
+	from := c.state
+	if c.generation == generation {
+		failed := outcome == circuitFailure
+		switch c.state {
+		case CircuitClosed:
+			if outcome == circuitCanceled {
+				break
+			}
+			total, failures := c.add(time.Now(), cb.window, failed)
+			if total >= cb.minRequests && float64(failures) >= cb.failureRatio*float64(total) {
+				c.transition(CircuitOpen)
+			}
+		case CircuitHalfOpen:
+			c.probesInFlight--
+			if outcome == circuitCanceled {
+				break
+			}
+			if failed {
+				c.transition(CircuitOpen)
+			} else if c.probeSuccesses++; c.probeSuccesses >= max(cb.probes, 1) {
+				c.transition(CircuitClosed)
+			}
+		}
+	}
+	to := c.state
+	cb.mu.Unlock()
+
+	cb.notify(key, from, to)
+}
+
+func (cb *CircuitBreaker) notify(key string, from, to CircuitState) {
+	if from != to && cb.onStateChange != nil {
+		cb.onStateChange(key, from, to)
+	}
+}
+
+// transition 状態を遷移し、集計をリセット
+func (c *circuit) transition(state CircuitState) {
+	c.state = state
+	c.generation++
+	c.buckets = [circuitBuckets]circuitBucket{}
+	c.probesInFlight = 0
+	c.probeSuccesses = 0
+	if state == CircuitOpen {
+		c.openedAt = time.Now()
+	}
+}
+
+// add 結果を時間窓に加え、時間窓内のリクエスト数と失敗数を返す
+func (c *circuit) add(now time.Time, window time.Duration, failed bool) (int, int) {
+	width := max(window/circuitBuckets, time.Nanosecond)
+	index := now.UnixNano() / int64(width)
+
+	b := &c.buckets[index%circuitBuckets]
+	if b.index != index {
+		*b = circuitBucket{index: index}
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+
+	total, failures := 0, 0
+	for _, b := range c.buckets {
+		if index-b.index < circuitBuckets {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return total, failures
+}
@@ -0,0 +1,155 @@
+package httpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+)
+
+type stateChange struct {
+	from, to httpc.CircuitState
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	s, count := newFlakyServer(t, 3, http.StatusServiceUnavailable, nil)
+	host := mustHost(t, s.URL)
+
+	var changes []stateChange
+	cb := httpc.NewCircuitBreaker().MinRequests(3).FailureRatio(0.5).Cooldown(50 * time.Millisecond).
+		OnStateChange(func(key string, from, to httpc.CircuitState) {
+			assert.Equal(t, host, key)
+			changes = append(changes, stateChange{from, to})
+		})
+	r := httpc.NewRequest[[]byte]().CircuitBreaker(cb)
+
+	for range 3 {
+		_, err := r.Get(context.Background(), s.URL)
+		var e *httpc.Error
+		assert.ErrorAs(t, err, &e)
+	}
+	assert.Equal(t, httpc.CircuitOpen, cb.State(host))
+
+	// 開いている間は接続しない
+	_, err := r.Get(context.Background(), s.URL)
+	var e *httpc.CircuitOpenError
+	if assert.ErrorAs(t, err, &e) {
+		assert.ErrorIs(t, err, httpc.ErrCircuitOpen)
+		assert.Equal(t, host, e.Key())
+	}
+	assert.Equal(t, int32(3), count.Load())
+
+	// Cooldown経過後の試験的なリクエストが成功すれば閉じる
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, httpc.CircuitHalfOpen, cb.State(host))
+	_, err = r.Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, httpc.CircuitClosed, cb.State(host))
+
+	assert.Equal(t, []stateChange{
+		{httpc.CircuitClosed, httpc.CircuitOpen},
+		{httpc.CircuitOpen, httpc.CircuitHalfOpen},
+		{httpc.CircuitHalfOpen, httpc.CircuitClosed},
+	}, changes)
+}
+
+func TestCircuitBreaker_ProbeFailure(t *testing.T) {
+	s, count := newFlakyServer(t, 10, http.StatusInternalServerError, nil)
+	host := mustHost(t, s.URL)
+
+	cb := httpc.NewCircuitBreaker().MinRequests(1).Cooldown(20 * time.Millisecond)
+	r := httpc.NewRequest[[]byte]().CircuitBreaker(cb)
+
+	_, _ = r.Get(context.Background(), s.URL)
+	assert.Equal(t, httpc.CircuitOpen, cb.State(host))
+
+	time.Sleep(30 * time.Millisecond)
+	_, err := r.Get(context.Background(), s.URL)
+	var e *httpc.Error
+	assert.ErrorAs(t, err, &e)
+	assert.Equal(t, httpc.CircuitOpen, cb.State(host))
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestCircuitBreaker_ProbeCanceled(t *testing.T) {
+	var count atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch count.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case 2:
+			// 試験的なリクエストをキャンセルされるまで待たせる
+			<-r.Context().Done()
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer s.Close()
+	host := mustHost(t, s.URL)
+
+	cb := httpc.NewCircuitBreaker().MinRequests(1).Cooldown(20 * time.Millisecond)
+	r := httpc.NewRequest[[]byte]().CircuitBreaker(cb)
+
+	_, _ = r.Get(context.Background(), s.URL)
+	assert.Equal(t, httpc.CircuitOpen, cb.State(host))
+	time.Sleep(30 * time.Millisecond)
+
+	// キャンセルされた試験的なリクエストは成功とみなさず、枠のみを解放する
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	go func() {
+		for count.Load() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	_, err := r.Get(ctx, s.URL)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, httpc.CircuitHalfOpen, cb.State(host))
+
+	_, err = r.Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, httpc.CircuitClosed, cb.State(host))
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestCircuitBreaker_Retry(t *testing.T) {
+	s, count := newFlakyServer(t, 10, http.StatusServiceUnavailable, nil)
+
+	cb := httpc.NewCircuitBreaker().MinRequests(2)
+	_, err := httpc.NewRequest[[]byte]().CircuitBreaker(cb).Retry(fastRetry().MaxAttempts(5)).
+		Get(context.Background(), s.URL)
+	assert.ErrorIs(t, err, httpc.ErrCircuitOpen)
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestCircuitBreaker_KeyFunc(t *testing.T) {
+	s, _ := newFlakyServer(t, 10, http.StatusServiceUnavailable, nil)
+
+	cb := httpc.NewCircuitBreaker().MinRequests(1).KeyFunc(func(r *http.Request) string {
+		return r.URL.Path
+	})
+	c := httpc.NewClient().BaseURL(s.URL).CircuitBreaker(cb)
+
+	_, _ = httpc.NewRequestFrom[[]byte](c).Get(context.Background(), "/a")
+	assert.Equal(t, httpc.CircuitOpen, cb.State("/a"))
+	assert.Equal(t, httpc.CircuitClosed, cb.State("/b"))
+
+	_, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), "/b")
+	assert.NotErrorIs(t, err, httpc.ErrCircuitOpen)
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
@@ -0,0 +1,234 @@
+package httpc
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/unvurn/httpc/codec"
+)
+
+// Client 複数のリクエストで共有する設定を保持する構造体
+//
+// ベースURL、既定のヘッダー、認証情報、コーデック、[http.Client] を保持し、
+// NewRequestFrom により各呼び出しごとの Request[T] を生成します。
+//
+// Client は不変であり、設定メソッドは変更を加えた新しい Client を返します。
+// このため、ひとつの Client を複数のgoroutineから安全に共有できます。
+type Client struct {
+	baseURL string
+
+	headers   http.Header
+	auth      Auth
+	keepAlive bool
+
+	codecs []codec.Codec
+
+	retryPolicy    *RetryPolicy
+	circuitBreaker *CircuitBreaker
+	rateLimiters   []*RateLimiter
+	middlewares    []Middleware
+	session        *Session
+	cache          *Cache
+
+	httpClient *http.Client
+}
+
+// NewClient Clientを生成する関数
+func NewClient() *Client {
+	return &Client{
+		headers: http.Header{},
+	}
+}
+
+// NewRequestFrom ClientからRequest[T]を生成する関数
+//
+// Clientの設定を複製した新しい Request[T] を返します。
+// 返された Request[T] への変更はClientや他のリクエストに影響しません。
+func NewRequestFrom[T any](c *Client) *Request[T] {
+	r := NewRequestFunc[T]()
+	r.baseURL = c.baseURL
+	r.headers = c.headers.Clone()
+	r.auth = c.auth
+	r.keepAlive = c.keepAlive
+	for _, cc := range c.codecs {
+		r.Codec(cc)
+	}
+	r.retryPolicy = c.retryPolicy
+	r.circuitBreaker = c.circuitBreaker
+	r.rateLimiters = slices.Clone(c.rateLimiters)
+	r.middlewares = slices.Clone(c.middlewares)
+	r.session = c.session
+	r.cache = c.cache
+	r.httpClient = c.httpClient
+	return r
+}
+
+// clone Clientの複製を返す
+func (c *Client) clone() *Client {
+	cc := *c
+	cc.headers = c.headers.Clone()
+	cc.codecs = slices.Clone(c.codecs)
+	cc.rateLimiters = slices.Clone(c.rateLimiters)
+	cc.middlewares = slices.Clone(c.middlewares)
+	return &cc
+}
+
+// BaseURL ベースURLを設定
+//
+// リクエスト時に指定された相対URLは、ベースURLのパスに連結されます。
+// 例えばベースURLが "https://api.example.com/v1" の場合、"users/1" および "/users/1" は
+// "https://api.example.com/v1/users/1" となります。絶対URLが指定された場合はベースURLは無視されます。
+func (c *Client) BaseURL(u string) *Client {
+	cc := c.clone()
+	cc.baseURL = u
+	return cc
+}
+
+// Header 既定のHTTPリクエストヘッダーを追加(key, valueによるstringペア)
+func (c *Client) Header(key, value string) *Client {
+	cc := c.clone()
+	cc.headers.Add(key, value)
+	return cc
+}
+
+// Auth 既定の認証方式を設定
+//
+// Auth はClientから生成されたすべてのリクエストで共有されます。詳細は Request.Auth を参照してください。
+func (c *Client) Auth(a Auth) *Client {
+	cc := c.clone()
+	cc.auth = a
+	return cc
+}
+
+// BasicAuth 既定のBasic認証を設定
+func (c *Client) BasicAuth(username, password string) *Client {
+	return c.Auth(BasicAuth(username, password))
+}
+
+// DigestAuth 既定のDigest認証を設定
+//
+// nonceはClientから生成されたすべてのリクエストで共有されます。詳細は DigestAuth を参照してください。
+func (c *Client) DigestAuth(username, password string) *Client {
+	return c.Auth(DigestAuth(username, password))
+}
+
+func (c *Client) KeepAlive(keepAlive bool) *Client {
+	cc := c.clone()
+	cc.keepAlive = keepAlive
+	return cc
+}
+
+// Codec 既定のコーデックを追加
+//
+// 詳細は Request.Codec を参照してください。
+func (c *Client) Codec(cd codec.Codec) *Client {
+	cc := c.clone()
+	cc.codecs = append(cc.codecs, cd)
+	return cc
+}
+
+// Retry 既定の再試行方針を設定
+//
+// 詳細は RetryPolicy を参照してください。
+func (c *Client) Retry(p *RetryPolicy) *Client {
+	cc := c.clone()
+	cc.retryPolicy = p
+	return cc
+}
+
+// CircuitBreaker 既定のサーキットブレーカーを設定
+//
+// CircuitBreaker はClientから生成されたすべてのリクエストで共有され、キー(既定ではホスト)ごとに状態を保持します。
+// 詳細は CircuitBreaker を参照してください。
+func (c *Client) CircuitBreaker(cb *CircuitBreaker) *Client {
+	cc := c.clone()
+	cc.circuitBreaker = cb
+	return cc
+}
+
+// RateLimit 既定の送信レートと同時実行数の制限を追加
+//
+// RateLimiter はClientから生成されたすべてのリクエストで共有されます。
+// リクエストごとに RateLimit で追加した制限は、Clientの制限に続けて適用されます。
+// 詳細は RateLimiter を参照してください。
+func (c *Client) RateLimit(l *RateLimiter) *Client {
+	cc := c.clone()
+	cc.rateLimiters = append(cc.rateLimiters, l)
+	return cc
+}
+
+// Use 既定のミドルウェアを追加
+//
+// 詳細は Request.Use を参照してください。
+func (c *Client) Use(middlewares ...Middleware) *Client {
+	cc := c.clone()
+	cc.middlewares = append(cc.middlewares, middlewares...)
+	return cc
+}
+
+// Session 既定のセッションを設定
+//
+// Session はClientから生成されたすべてのリクエストで共有され、レスポンスで受け取ったCookieを以降のリクエストで送信します。
+// 詳細は Session を参照してください。
+func (c *Client) Session(s *Session) *Client {
+	cc := c.clone()
+	cc.session = s
+	return cc
+}
+
+// Cache 既定のキャッシュを設定
+//
+// Cache はClientから生成されたすべてのリクエストで共有されます。詳細は Cache を参照してください。
+func (c *Client) Cache(cache *Cache) *Client {
+	cc := c.clone()
+	cc.cache = cache
+	return cc
+}
+
+func (c *Client) HTTPClient(hc *http.Client) *Client {
+	cc := c.clone()
+	cc.httpClient = hc
+	return cc
+}
+
+// resolveURL ベースURLに対して相対URLを解決
+//
+// refが絶対URL(スキームもしくはホストを含む)の場合はそのまま返します。
+// それ以外の場合はベースURLのパスにrefのパスをエスケープされたまま(ドットセグメントも正規化せずに)連結し、
+// クエリパラメータを併合します。
+func resolveURL(base, ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if base == "" || u.IsAbs() || u.Host != "" {
+		return ref, nil
+	}
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	// パスパラメータに含まれる "%2F" 等を保持するため、エスケープされたパスのまま連結する
+	resolved := *b
+	if ref := strings.TrimPrefix(u.EscapedPath(), "/"); ref != "" {
+		escaped := strings.TrimSuffix(b.EscapedPath(), "/") + "/" + ref
+		if resolved.Path, err = url.PathUnescape(escaped); err != nil {
+			return "", err
+		}
+		resolved.RawPath = escaped
+	}
+	if u.RawQuery != "" {
+		q := resolved.Query()
+		for k, vv := range u.Query() {
+			for _, v := range vv {
+				q.Add(k, v)
+			}
+		}
+		resolved.RawQuery = q.Encode()
+	}
+	resolved.Fragment = u.Fragment
+	return resolved.String(), nil
+}
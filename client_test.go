@@ -0,0 +1,117 @@
+package httpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/codec"
+)
+
+type echoResponse struct {
+	Path   string            `json:"path"`
+	Query  map[string]string `json:"query"`
+	Header map[string]string `json:"header"`
+}
+
+func newClientEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := echoResponse{Path: r.URL.Path, Query: map[string]string{}, Header: map[string]string{}}
+		for k := range r.URL.Query() {
+			resp.Query[k] = r.URL.Query().Get(k)
+		}
+		for k := range r.Header {
+			resp.Header[k] = r.Header.Get(k)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClient(t *testing.T) {
+	s := newClientEchoServer(t)
+
+	c := httpc.NewClient().
+		BaseURL(s.URL+"/v1?version=1").
+		Header("X-Client", "httpc").
+		BasicAuth("user", "password").
+		Codec(codec.JSON())
+
+	v, err := httpc.NewRequestFrom[echoResponse](c).Get(context.Background(), "users/1?expand=true")
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1/users/1", v.Path)
+	assert.Equal(t, map[string]string{"version": "1", "expand": "true"}, v.Query)
+	assert.Equal(t, "httpc", v.Header["X-Client"])
+	assert.Equal(t, "application/json", v.Header["Accept"])
+	assert.NotEmpty(t, v.Header["Authorization"])
+
+	v, err = httpc.NewRequestFrom[echoResponse](c).Get(context.Background(), "/users/2")
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1/users/2", v.Path)
+
+	v, err = httpc.NewRequestFrom[echoResponse](c).Get(context.Background(), s.URL+"/absolute")
+	assert.NoError(t, err)
+	assert.Equal(t, "/absolute", v.Path)
+}
+
+func TestClient_EscapedPath(t *testing.T) {
+	var uris []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uris = append(uris, r.RequestURI)
+	}))
+	defer s.Close()
+
+	// パスパラメータに含まれる "/" のエスケープを保持する
+	c := httpc.NewClient().BaseURL(s.URL + "/v1/")
+	_, err := httpc.NewRequestFrom[[]byte](c).TryGet(context.Background(), "files/a%2Fb.txt")
+	assert.NoError(t, err)
+	_, err = httpc.NewRequestFrom[[]byte](c).TryGet(context.Background(), "/users/"+url.PathEscape("x/y z"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/v1/files/a%2Fb.txt", "/v1/users/x%2Fy%20z"}, uris)
+}
+
+func TestClient_Immutable(t *testing.T) {
+	s := newClientEchoServer(t)
+
+	base := httpc.NewClient().BaseURL(s.URL).Codec(codec.JSON())
+	derived := base.Header("X-Derived", "1")
+
+	v, err := httpc.NewRequestFrom[echoResponse](base).Header("X-Request", "1").Get(context.Background(), "/")
+	assert.NoError(t, err)
+	assert.NotContains(t, v.Header, "X-Derived")
+
+	v, err = httpc.NewRequestFrom[echoResponse](derived).Get(context.Background(), "/")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", v.Header["X-Derived"])
+	assert.NotContains(t, v.Header, "X-Request")
+}
+
+func TestClient_Concurrent(t *testing.T) {
+	s := newClientEchoServer(t)
+	c := httpc.NewClient().BaseURL(s.URL).Codec(codec.JSON())
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := strconv.Itoa(i)
+			v, err := httpc.NewRequestFrom[echoResponse](c).Header("X-N", n).Get(context.Background(), "/items", "n", n)
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{"n": n}, v.Query)
+			assert.Equal(t, n, v.Header["X-N"])
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,31 @@
+package codec
+
+import (
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBORCodec application/cbor形式(RFC 8949)のコーデック
+//
+// application/cbor に加え、"+cbor" サフィックスを持つメディアタイプもデコード対象とします。
+type CBORCodec struct{}
+
+// CBOR CBORCodecを生成する関数
+func CBOR() *CBORCodec {
+	return &CBORCodec{}
+}
+
+func (c *CBORCodec) ContentType() string {
+	return "application/cbor"
+}
+
+func (c *CBORCodec) Match(contentType string) bool {
+	return matchMediaType(contentType, "application/cbor", "+cbor")
+}
+
+func (c *CBORCodec) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (c *CBORCodec) Unmarshal(data []byte, v any) error {
+	return cbor.Unmarshal(data, v)
+}
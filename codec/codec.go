@@ -0,0 +1,36 @@
+package codec
+
+import (
+	"mime"
+	"strings"
+)
+
+// Codec リクエストボディのエンコードおよびレスポンスボディのデコードを行うためのインターフェイス
+//
+// ひとつのメディアタイプに対するエンコードとデコードの組を表します。
+// [github.com/unvurn/httpc.Request.Codec] に渡すことで、エンコーダー・デコーダー・Acceptヘッダーをまとめて設定できます。
+type Codec interface {
+	// ContentType エンコード時に使用するContent-Typeを返す
+	ContentType() string
+	// Match 与えられたContent-Typeのレスポンスボディをデコード可能かを返す
+	Match(contentType string) bool
+	// Marshal 値をバイト列にエンコード
+	Marshal(v any) ([]byte, error)
+	// Unmarshal バイト列をvが指す値にデコード
+	Unmarshal(data []byte, v any) error
+}
+
+// matchMediaType Content-Typeが指定のメディアタイプ、もしくは構造化構文サフィックスに一致するかを判定
+//
+// mediaTypeは "application/json" のような完全一致の対象、suffixは "+json" のような
+// RFC 6839 の構造化構文サフィックスを表します。パラメータ(charset等)は無視されます。
+func matchMediaType(contentType, mediaType, suffix string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mt == mediaType {
+		return true
+	}
+	return suffix != "" && strings.HasSuffix(mt, suffix)
+}
@@ -0,0 +1,61 @@
+package codec_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc/codec"
+)
+
+type sample struct {
+	Name   string `json:"name" xml:"name" msgpack:"name" cbor:"name"`
+	Age    int    `json:"age" xml:"age" msgpack:"age" cbor:"age"`
+	Scores []int  `json:"scores" xml:"scores" msgpack:"scores" cbor:"scores"`
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	in := sample{Name: "John Doe", Age: 25, Scores: []int{100, 90, 80}}
+
+	for _, c := range []codec.Codec{codec.JSON(), codec.XML(), codec.MsgPack(), codec.CBOR()} {
+		t.Run(c.ContentType(), func(t *testing.T) {
+			assert.True(t, c.Match(c.ContentType()))
+
+			b, err := c.Marshal(in)
+			assert.NoError(t, err)
+
+			var out sample
+			err = c.Unmarshal(b, &out)
+			assert.NoError(t, err)
+			assert.Equal(t, in, out)
+		})
+	}
+}
+
+func TestCodec_Match(t *testing.T) {
+	assert.True(t, codec.XML().Match("text/xml; charset=utf-8"))
+	assert.True(t, codec.XML().Match("application/problem+xml"))
+	assert.False(t, codec.XML().Match("application/json"))
+
+	assert.True(t, codec.MsgPack().Match("application/x-msgpack"))
+	assert.True(t, codec.MsgPack().Match("application/vnd.msgpack"))
+	assert.False(t, codec.MsgPack().Match("application/cbor"))
+
+	assert.True(t, codec.CBOR().Match("application/cose+cbor"))
+	assert.False(t, codec.CBOR().Match("application/msgpack"))
+}
+
+func TestMsgPack_StructTag(t *testing.T) {
+	type tagged struct {
+		Name string `json:"full_name"`
+	}
+
+	c := codec.MsgPack().StructTag("json")
+	b, err := c.Marshal(tagged{Name: "a"})
+	assert.NoError(t, err)
+
+	var m map[string]string
+	err = codec.MsgPack().Unmarshal(b, &m)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", m["full_name"])
+}
@@ -0,0 +1,73 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var ErrTrailingData = errors.New("codec: unexpected data after top-level JSON value")
+
+// JSONCodec application/json形式のコーデック
+//
+// application/json に加え、application/problem+json や application/vnd.github+json のような
+// "+json" サフィックスを持つメディアタイプもデコード対象とします。
+type JSONCodec struct {
+	disallowUnknownFields bool
+	useNumber             bool
+}
+
+// JSON JSONCodecを生成する関数
+func JSON() *JSONCodec {
+	return &JSONCodec{}
+}
+
+// DisallowUnknownFields デコード先に存在しないフィールドを含むJSONをエラーとする
+//
+// [json.Decoder.DisallowUnknownFields] を参照してください。
+func (c *JSONCodec) DisallowUnknownFields() *JSONCodec {
+	c.disallowUnknownFields = true
+	return c
+}
+
+// UseNumber 数値を float64 ではなく [json.Number] としてデコードする
+//
+// [json.Decoder.UseNumber] を参照してください。
+func (c *JSONCodec) UseNumber() *JSONCodec {
+	c.useNumber = true
+	return c
+}
+
+func (c *JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+func (c *JSONCodec) Match(contentType string) bool {
+	return matchMediaType(contentType, "application/json", "+json")
+}
+
+func (c *JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c *JSONCodec) Unmarshal(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	if c.disallowUnknownFields {
+		d.DisallowUnknownFields()
+	}
+	if c.useNumber {
+		d.UseNumber()
+	}
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	// json.Unmarshal と同様に、値の後に続くデータ(空白を除く)をエラーとする
+	if err := d.Decode(&json.RawMessage{}); err != io.EOF {
+		if err == nil {
+			err = ErrTrailingData
+		}
+		return err
+	}
+	return nil
+}
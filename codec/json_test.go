@@ -0,0 +1,48 @@
+package codec_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc/codec"
+)
+
+func TestJSON_Match(t *testing.T) {
+	c := codec.JSON()
+	assert.True(t, c.Match("application/json"))
+	assert.True(t, c.Match("application/json; charset=utf-8"))
+	assert.True(t, c.Match("application/problem+json"))
+	assert.True(t, c.Match("application/vnd.github+json"))
+	assert.False(t, c.Match("application/xml"))
+	assert.False(t, c.Match("text/html"))
+	assert.False(t, c.Match(""))
+}
+
+func TestJSON_Unmarshal(t *testing.T) {
+	type value struct {
+		Name string `json:"name"`
+	}
+
+	var v value
+	err := codec.JSON().Unmarshal([]byte(`{"name":"a","age":1}`), &v)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", v.Name)
+
+	err = codec.JSON().DisallowUnknownFields().Unmarshal([]byte(`{"name":"a","age":1}`), &v)
+	assert.Error(t, err)
+
+	// 値の後に続くデータはエラーとする
+	err = codec.JSON().Unmarshal([]byte(`{"name":"a"}garbage`), &v)
+	assert.Error(t, err)
+	err = codec.JSON().Unmarshal([]byte(`{"name":"a"}{"name":"b"}`), &v)
+	assert.ErrorIs(t, err, codec.ErrTrailingData)
+	err = codec.JSON().Unmarshal([]byte("{\"name\":\"a\"}\n"), &v)
+	assert.NoError(t, err)
+
+	var m map[string]any
+	err = codec.JSON().UseNumber().Unmarshal([]byte(`{"n":12345678901234567890}`), &m)
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("12345678901234567890"), m["n"])
+}
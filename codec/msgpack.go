@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgPackCodec application/msgpack形式のコーデック
+//
+// application/msgpack に加え、慣用的に用いられる application/x-msgpack および
+// application/vnd.msgpack、"+msgpack" サフィックスを持つメディアタイプもデコード対象とします。
+type MsgPackCodec struct {
+	structTag string
+}
+
+// MsgPack MsgPackCodecを生成する関数
+func MsgPack() *MsgPackCodec {
+	return &MsgPackCodec{}
+}
+
+// StructTag 構造体のフィールド名の解決に使用するタグを指定
+//
+// 既定では "msgpack" タグが使用されます。"json" を指定するとJSONと同じ構造体定義を共用できます。
+func (c *MsgPackCodec) StructTag(tag string) *MsgPackCodec {
+	c.structTag = tag
+	return c
+}
+
+func (c *MsgPackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (c *MsgPackCodec) Match(contentType string) bool {
+	return matchMediaType(contentType, "application/msgpack", "+msgpack") ||
+		matchMediaType(contentType, "application/x-msgpack", "") ||
+		matchMediaType(contentType, "application/vnd.msgpack", "")
+}
+
+func (c *MsgPackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	e := msgpack.NewEncoder(&buf)
+	if c.structTag != "" {
+		e.SetCustomStructTag(c.structTag)
+	}
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *MsgPackCodec) Unmarshal(data []byte, v any) error {
+	d := msgpack.NewDecoder(bytes.NewReader(data))
+	if c.structTag != "" {
+		d.SetCustomStructTag(c.structTag)
+	}
+	return d.Decode(v)
+}
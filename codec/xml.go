@@ -0,0 +1,48 @@
+package codec
+
+import (
+	"encoding/xml"
+)
+
+// XMLCodec application/xml形式のコーデック
+//
+// application/xml および text/xml に加え、application/problem+xml のような
+// "+xml" サフィックスを持つメディアタイプもデコード対象とします。
+type XMLCodec struct {
+	header bool
+}
+
+// XML XMLCodecを生成する関数
+func XML() *XMLCodec {
+	return &XMLCodec{}
+}
+
+// Header エンコード時にXML宣言(<?xml ...?>)を先頭に付与する
+func (c *XMLCodec) Header() *XMLCodec {
+	c.header = true
+	return c
+}
+
+func (c *XMLCodec) ContentType() string {
+	return "application/xml"
+}
+
+func (c *XMLCodec) Match(contentType string) bool {
+	return matchMediaType(contentType, "application/xml", "+xml") ||
+		matchMediaType(contentType, "text/xml", "")
+}
+
+func (c *XMLCodec) Marshal(v any) ([]byte, error) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if c.header {
+		b = append([]byte(xml.Header), b...)
+	}
+	return b, nil
+}
+
+func (c *XMLCodec) Unmarshal(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
@@ -0,0 +1,340 @@
+package httpc
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DigestAuth Digest認証(RFC 7616)を行うAuthを返す
+//
+// 最初のリクエストは認証情報を付与せずに送信し、401 Unauthorized のレスポンスに含まれる
+// WWW-Authenticateヘッダーのチャレンジに応じて認証情報を付与して再送します。
+// 受け取ったnonceはホストごとに保持し、以降のリクエストではnonceカウントを増やしながら再利用します。
+// サーバーがnonceの失効(stale=true)を通知した場合は、新しいnonceにより再送します。
+//
+// アルゴリズムは MD5, SHA-256, SHA-512-256 およびそれぞれの -sess 版に対応し、複数提示された場合はより強いものを選択します。
+// qopは auth を優先し、auth-int のみが提示された場合はボディ(http.Request.GetBody により再取得)のハッシュを含めます。
+// 返されるAuthは複数のリクエスト・goroutineから共有できます。Client に設定することで、nonceを各リクエストで共有できます。
+func DigestAuth(username, password string) Auth {
+	return &digestAuth{
+		username:   username,
+		password:   password,
+		challenges: map[string]*digestChallenge{},
+	}
+}
+
+type digestAuth struct {
+	username string
+	password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// digestChallenge サーバーから受け取ったチャレンジと、それに対するnonceカウント
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	nc        uint32
+	// cnonce -sess 版のアルゴリズムにおいてセッション鍵の算出に用いるcnonce
+	cnonce string
+}
+
+// digestAlgorithms 対応するアルゴリズム(弱い順)
+var digestAlgorithms = []string{"MD5", "SHA-256", "SHA-512-256"}
+
+func (a *digestAuth) Apply(req *http.Request) error {
+	a.mu.Lock()
+	c, ok := a.challenges[req.URL.Host]
+	if !ok {
+		a.mu.Unlock()
+		return nil
+	}
+	c.nc++
+	ch := *c
+	a.mu.Unlock()
+
+	v, err := a.authorization(req, &ch)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", v)
+	return nil
+}
+
+func (a *digestAuth) Challenge(res *http.Response) (bool, error) {
+	params, ok := selectDigestChallenge(res.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return false, nil
+	}
+
+	// 同じnonceで認証に失敗した場合は、nonceの失効でない限り認証情報の誤りとみなす
+	sent := parseAuthParams(strings.TrimPrefix(res.Request.Header.Get("Authorization"), "Digest "))
+	if sent["nonce"] == params["nonce"] && !strings.EqualFold(params["stale"], "true") {
+		return false, nil
+	}
+
+	c := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+		qop:       selectQop(params["qop"]),
+		userhash:  strings.EqualFold(params["userhash"], "true"),
+	}
+	if c.algorithm == "" {
+		c.algorithm = "MD5"
+	}
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		c.cnonce = newCnonce()
+	}
+
+	a.mu.Lock()
+	a.challenges[res.Request.URL.Host] = c
+	a.mu.Unlock()
+	return true, nil
+}
+
+// authorization チャレンジに対するAuthorizationヘッダーの値を返す
+func (a *digestAuth) authorization(req *http.Request, c *digestChallenge) (string, error) {
+	algorithm, sess := strings.CutSuffix(strings.ToUpper(c.algorithm), "-SESS")
+	h := digestHash(algorithm)
+	if h == nil {
+		return "", fmt.Errorf("unsupported digest algorithm: %s", c.algorithm)
+	}
+
+	uri := req.URL.RequestURI()
+	nc := fmt.Sprintf("%08x", c.nc)
+	cnonce := c.cnonce
+	if cnonce == "" {
+		cnonce = newCnonce()
+	}
+
+	ha1 := h(a.username + ":" + c.realm + ":" + a.password)
+	if sess {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+
+	a2 := req.Method + ":" + uri
+	if c.qop == "auth-int" {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return "", err
+		}
+		a2 += ":" + h(string(body))
+	}
+
+	var response string
+	if c.qop == "" {
+		// RFC 2069 との互換
+		response = h(ha1 + ":" + c.nonce + ":" + h(a2))
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":" + c.qop + ":" + h(a2))
+	}
+
+	username := a.username
+	if c.userhash {
+		username = h(a.username + ":" + c.realm)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Digest username=%s, realm=%s, uri=%s, algorithm=%s, nonce=%s",
+		quote(username), quote(c.realm), quote(uri), c.algorithm, quote(c.nonce))
+	if c.qop != "" {
+		fmt.Fprintf(&b, ", nc=%s, cnonce=%s, qop=%s", nc, quote(cnonce), c.qop)
+	}
+	fmt.Fprintf(&b, ", response=%s", quote(response))
+	if c.opaque != "" {
+		fmt.Fprintf(&b, ", opaque=%s", quote(c.opaque))
+	}
+	if c.userhash {
+		b.WriteString(", userhash=true")
+	}
+	return b.String(), nil
+}
+
+// digestHash アルゴリズム名に対応するハッシュ関数(16進文字列を返す)を返す
+func digestHash(algorithm string) func(string) string {
+	var f func() hash.Hash
+	switch algorithm {
+	case "MD5":
+		f = md5.New
+	case "SHA-256":
+		f = sha256.New
+	case "SHA-512-256":
+		f = sha512.New512_256
+	default:
+		return nil
+	}
+	return func(s string) string {
+		h := f()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+// readRequestBody リクエストのボディを読み込む
+//
+// http.Request.GetBody によりボディを再取得するため、送信するボディには影響しません。
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody == nil {
+		if req.Body == nil || req.Body == http.NoBody {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("digest qop=auth-int requires a replayable request body")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+	return io.ReadAll(body)
+}
+
+// selectDigestChallenge WWW-Authenticateヘッダーから対応するDigestチャレンジのうち最も強いものを選択
+func selectDigestChallenge(values []string) (map[string]string, bool) {
+	var best map[string]string
+	bestRank := -1
+	for _, v := range values {
+		for _, c := range parseChallenges(v) {
+			if !strings.EqualFold(c.scheme, "Digest") || c.params["nonce"] == "" {
+				continue
+			}
+			algorithm := c.params["algorithm"]
+			if algorithm == "" {
+				algorithm = "MD5"
+			}
+			base, _ := strings.CutSuffix(strings.ToUpper(algorithm), "-SESS")
+			rank := slices.Index(digestAlgorithms, base)
+			if rank > bestRank {
+				best, bestRank = c.params, rank
+			}
+		}
+	}
+	return best, best != nil
+}
+
+// selectQop 提示されたqopから使用するものを選択
+func selectQop(offered string) string {
+	if offered == "" {
+		return ""
+	}
+	var qops []string
+	for _, q := range strings.Split(offered, ",") {
+		qops = append(qops, strings.ToLower(strings.TrimSpace(q)))
+	}
+	if slices.Contains(qops, "auth") {
+		return "auth"
+	}
+	if slices.Contains(qops, "auth-int") {
+		return "auth-int"
+	}
+	return ""
+}
+
+// challenge WWW-Authenticateヘッダーのチャレンジ(RFC 9110 Section 11.6.1)
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+// parseChallenges WWW-Authenticateヘッダーの値をチャレンジの一覧として解釈
+//
+// 1つのヘッダー値に複数のチャレンジを含む場合("Basic realm=..., Digest realm=...")にも対応します。
+// パラメータ名は小文字に正規化されます。token68形式のチャレンジのパラメータは無視します。
+func parseChallenges(s string) []challenge {
+	var cs []challenge
+	for s = strings.TrimLeft(s, " \t,"); s != ""; s = strings.TrimLeft(s, " \t,") {
+		token, rest := cutToken(s)
+		if token == "" {
+			// 解釈できない文字は読み飛ばす
+			s = s[1:]
+			continue
+		}
+		rest = strings.TrimLeft(rest, " \t")
+		if !strings.HasPrefix(rest, "=") || len(cs) == 0 {
+			// パラメータでなければ新しいチャレンジの開始
+			cs = append(cs, challenge{scheme: token, params: map[string]string{}})
+			s = rest
+			continue
+		}
+
+		rest = strings.TrimLeft(rest[1:], " \t")
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest = cutQuoted(rest)
+		} else {
+			value, rest = cutToken(rest)
+			// token68の末尾の "=" を読み飛ばす
+			rest = strings.TrimLeft(rest, "=")
+		}
+		cs[len(cs)-1].params[strings.ToLower(token)] = value
+		s = rest
+	}
+	return cs
+}
+
+// parseAuthParams カンマ区切りの認証パラメータを解釈
+func parseAuthParams(s string) map[string]string {
+	cs := parseChallenges("_ " + s)
+	if len(cs) == 0 {
+		return map[string]string{}
+	}
+	return cs[0].params
+}
+
+// cutToken 先頭のトークン(RFC 9110 Section 5.6.2)を切り出す
+func cutToken(s string) (string, string) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+	})
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// cutQuoted 先頭の引用文字列(RFC 9110 Section 5.6.4)を切り出し、エスケープを解除して返す
+func cutQuoted(s string) (string, string) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// quote 文字列を引用文字列として返す
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// newCnonce クライアントnonceを生成
+func newCnonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
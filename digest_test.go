@@ -0,0 +1,164 @@
+package httpc_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/codec"
+)
+
+// digestResponse RFC 7616 Section 3.4.1 に従ってresponseの値を算出
+func digestResponse(newHash func() hash.Hash, sess bool, username, realm, password, method, uri, nonce, nc, cnonce, qop string, body []byte) string {
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	ha1 := h(username + ":" + realm + ":" + password)
+	if sess {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	a2 := method + ":" + uri
+	if qop == "auth-int" {
+		a2 += ":" + h(string(body))
+	}
+	return h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + h(a2))
+}
+
+var authParamPattern = regexp.MustCompile(`(\w+)=(?:"((?:[^"\\]|\\.)*)"|([^,\s]*))`)
+
+func parseDigest(v string) map[string]string {
+	params := map[string]string{}
+	for _, m := range authParamPattern.FindAllStringSubmatch(strings.TrimPrefix(v, "Digest "), -1) {
+		params[m[1]] = m[2] + m[3]
+	}
+	return params
+}
+
+// digestServer テスト用のDigest認証サーバー
+type digestServer struct {
+	*httptest.Server
+	algorithm string
+	qop       string
+	password  string
+
+	mu       sync.Mutex
+	nonce    string
+	stale    map[string]bool
+	requests int
+	ncs      []string
+}
+
+func newDigestServer(t *testing.T, algorithm, qop string) *digestServer {
+	t.Helper()
+	ds := &digestServer{algorithm: algorithm, qop: qop, password: "Circle of Life", nonce: "n1", stale: map[string]bool{}}
+	ds.Server = httptest.NewServer(http.HandlerFunc(ds.serve))
+	t.Cleanup(ds.Close)
+	return ds
+}
+
+func (ds *digestServer) serve(w http.ResponseWriter, r *http.Request) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.requests++
+
+	body, _ := io.ReadAll(r.Body)
+	p := parseDigest(r.Header.Get("Authorization"))
+	newHash := md5.New
+	if strings.HasPrefix(ds.algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	want := digestResponse(newHash, strings.HasSuffix(ds.algorithm, "-sess"), "Mufasa", "http-auth@example.org", ds.password,
+		r.Method, r.URL.RequestURI(), p["nonce"], p["nc"], p["cnonce"], p["qop"], body)
+
+	if p["nonce"] == ds.nonce && p["response"] == want && p["opaque"] == "op" && p["uri"] == r.URL.RequestURI() {
+		ds.ncs = append(ds.ncs, p["nc"])
+		_, _ = w.Write([]byte("ok"))
+		return
+	}
+
+	stale := ""
+	if ds.stale[p["nonce"]] {
+		stale = ", stale=true"
+	}
+	w.Header().Add("WWW-Authenticate", `Basic realm="http-auth@example.org"`)
+	w.Header().Add("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="`+ds.qop+`", algorithm=MD5, nonce="`+ds.nonce+`", opaque="op"`+stale)
+	if ds.algorithm != "MD5" {
+		w.Header().Add("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="`+ds.qop+`", algorithm=`+ds.algorithm+`, nonce="`+ds.nonce+`", opaque="op"`+stale)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func TestDigestResponse(t *testing.T) {
+	// RFC 7616 Section 3.9.1
+	args := []string{"Mufasa", "http-auth@example.org", "Circle of Life", "GET", "/dir/index.html",
+		"7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "00000001", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "auth"}
+	assert.Equal(t, "8ca523f5e9506fed4657c9700eebdbec",
+		digestResponse(md5.New, false, args[0], args[1], args[2], args[3], args[4], args[5], args[6], args[7], args[8], nil))
+	assert.Equal(t, "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		digestResponse(sha256.New, false, args[0], args[1], args[2], args[3], args[4], args[5], args[6], args[7], args[8], nil))
+}
+
+func TestClient_DigestAuth(t *testing.T) {
+	ds := newDigestServer(t, "MD5", "auth,auth-int")
+	c := httpc.NewClient().BaseURL(ds.URL).DigestAuth("Mufasa", "Circle of Life")
+
+	for range 2 {
+		b, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), "/dir/index.html", "a", "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(b))
+	}
+	// 2回目のリクエストはnonceを再利用する
+	assert.Equal(t, 3, ds.requests)
+	assert.Equal(t, []string{"00000001", "00000002"}, ds.ncs)
+}
+
+func TestRequest_DigestAuth_AuthInt(t *testing.T) {
+	ds := newDigestServer(t, "SHA-256-sess", "auth-int")
+
+	r := httpc.NewRequest[map[string]any]().Codec(codec.JSON()).DigestAuth("Mufasa", "Circle of Life")
+	_, err := r.TryPut(context.Background(), ds.URL+"/items/1", map[string]int{"a": 1})
+	assert.NoError(t, err)
+	_, err = r.TryPut(context.Background(), ds.URL+"/items/2", map[string]int{"b": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, ds.requests)
+}
+
+func TestRequest_DigestAuth_Stale(t *testing.T) {
+	ds := newDigestServer(t, "SHA-256", "auth")
+
+	r := httpc.NewRequest[[]byte]().DigestAuth("Mufasa", "Circle of Life")
+	_, err := r.Get(context.Background(), ds.URL)
+	assert.NoError(t, err)
+
+	ds.mu.Lock()
+	ds.stale["n1"] = true
+	ds.nonce = "n2"
+	ds.mu.Unlock()
+
+	_, err = r.Get(context.Background(), ds.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, ds.requests)
+	assert.Equal(t, []string{"00000001", "00000001"}, ds.ncs)
+}
+
+func TestRequest_DigestAuth_WrongPassword(t *testing.T) {
+	ds := newDigestServer(t, "MD5", "auth")
+
+	_, err := httpc.NewRequest[[]byte]().DigestAuth("Mufasa", "wrong").Get(context.Background(), ds.URL)
+	assert.ErrorIs(t, err, httpc.ErrUnauthorized)
+	assert.Equal(t, 2, ds.requests)
+}
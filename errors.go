@@ -2,17 +2,51 @@ package httpc
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 var ErrNoAvailableEncoder = errors.New("no available encoder")
 var ErrNoAvailableDecoder = errors.New("no available decoder")
 var ErrUnexpectedType = errors.New("unexpected type")
+var ErrNotAcceptable = errors.New("not acceptable")
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+var ErrNoToken = errors.New("no token available")
+var ErrBodyNotReplayable = errors.New("request body cannot be replayed")
 
+// ステータスコードに対応するエラー
+//
+// *Error は errors.Is によりこれらと比較できます。
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrClientError  = errors.New("client error")
+	ErrServerError  = errors.New("server error")
+)
+
+// errorBodyPreviewSize Error() に含めるレスポンスボディの最大バイト数
+const errorBodyPreviewSize = 256
+
+// Error 成功とみなされなかったHTTPレスポンスを表すエラー
+//
+// Error() はメソッド、URL(認証情報や秘匿すべきクエリパラメータは伏字)、ステータス、ボディの先頭部分を含みます。
 type Error struct {
 	response *http.Response
 
-	body []byte
+	body           []byte
+	attempts       int
+	idempotencyKey string
 }
 
 func newError(response *http.Response, body []byte) error {
@@ -20,7 +54,19 @@ func newError(response *http.Response, body []byte) error {
 }
 
 func (e *Error) Error() string {
-	return e.response.Status
+	s := e.summary()
+	if preview := e.BodyPreview(); preview != "" {
+		s += ": " + preview
+	}
+	return s
+}
+
+// summary メソッド、URL、ステータスからなるエラーの要約を返す
+func (e *Error) summary() string {
+	if e.response.Request == nil || e.response.Request.URL == nil {
+		return e.response.Status
+	}
+	return e.Method() + " " + e.URL() + ": " + e.response.Status
 }
 
 func (e *Error) StatusCode() int {
@@ -30,3 +76,284 @@ func (e *Error) StatusCode() int {
 func (e *Error) Body() []byte {
 	return e.body
 }
+
+// Attempts 当該エラーに至るまでの試行回数を返す
+//
+// 再試行(Request.Retry を参照)を行わなかった場合は1を返します。
+func (e *Error) Attempts() int {
+	return max(e.attempts, 1)
+}
+
+// IdempotencyKey リクエストに付与したべき等キーを返す
+//
+// べき等キー(Request.IdempotencyKey を参照)を付与しなかった場合は空文字列を返します。
+func (e *Error) IdempotencyKey() string {
+	return e.idempotencyKey
+}
+
+// Header レスポンスヘッダーを返す
+func (e *Error) Header() http.Header {
+	return e.response.Header
+}
+
+// Method リクエストのメソッドを返す
+func (e *Error) Method() string {
+	if e.response.Request == nil {
+		return ""
+	}
+	return e.response.Request.Method
+}
+
+// URL リクエストのURLを返す
+//
+// ユーザー情報のパスワード、および秘匿すべきクエリパラメータ(access_token, api_key 等)の値は伏字となります。
+func (e *Error) URL() string {
+	if e.response.Request == nil || e.response.Request.URL == nil {
+		return ""
+	}
+	return redactURL(e.response.Request.URL)
+}
+
+// BodyPreview レスポンスボディの先頭部分を返す
+//
+// ログ出力を想定し、制御文字を空白に置き換え、一定の長さを超える部分を省略します。
+func (e *Error) BodyPreview() string {
+	b := e.body
+	truncated := false
+	if len(b) > errorBodyPreviewSize {
+		b = b[:errorBodyPreviewSize]
+		for len(b) > 0 && !utf8.Valid(b) {
+			b = b[:len(b)-1]
+		}
+		truncated = true
+	}
+
+	s := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, string(b)))
+	if truncated {
+		s += "..."
+	}
+	return s
+}
+
+// IsClientError ステータスコードが4xxであるかを返す
+func (e *Error) IsClientError() bool {
+	return e.response.StatusCode >= 400 && e.response.StatusCode < 500
+}
+
+// IsServerError ステータスコードが5xxであるかを返す
+func (e *Error) IsServerError() bool {
+	return e.response.StatusCode >= 500 && e.response.StatusCode < 600
+}
+
+// IsRetryable 同じリクエストを再試行することで成功する可能性があるかを返す
+//
+// 408, 425, 429, 502, 503, 504 を再試行可能とみなします。
+func (e *Error) IsRetryable() bool {
+	return isRetryableStatus(e.response.StatusCode)
+}
+
+// RetryAfter Retry-Afterヘッダーが示す待機時間を返す
+//
+// 秒数とHTTP-date(RFC 9110 Section 10.2.3)の双方の形式を解釈します。
+// ヘッダーが存在しない、もしくは解釈できない場合は第2返値がfalseとなります。
+func (e *Error) RetryAfter() (time.Duration, bool) {
+	return parseRetryAfter(e.response.Header.Get("Retry-After"), time.Now())
+}
+
+// Is ステータスコードに対応するエラー(ErrNotFound 等)と比較
+func (e *Error) Is(target error) bool {
+	code := e.response.StatusCode
+	switch target {
+	case ErrBadRequest:
+		return code == http.StatusBadRequest
+	case ErrUnauthorized:
+		return code == http.StatusUnauthorized
+	case ErrForbidden:
+		return code == http.StatusForbidden
+	case ErrNotFound:
+		return code == http.StatusNotFound
+	case ErrConflict:
+		return code == http.StatusConflict
+	case ErrRateLimited:
+		return code == http.StatusTooManyRequests
+	case ErrClientError:
+		return e.IsClientError()
+	case ErrServerError:
+		return e.IsServerError()
+	default:
+		return false
+	}
+}
+
+// isRetryableStatus 再試行可能なステータスコードであるかを返す
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout,
+		http.StatusTooEarly,
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter Retry-Afterヘッダーの値を待機時間として解釈
+//
+// 過去の日時が指定された場合は0を返します。
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
+
+// sensitiveQueryKeys URLを文字列化する際に値を伏字とするクエリパラメータ
+var sensitiveQueryKeys = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"client_secret",
+	"code",
+	"key",
+	"password",
+	"refresh_token",
+	"secret",
+	"sig",
+	"signature",
+	"token",
+	"x-amz-credential",
+	"x-amz-security-token",
+	"x-amz-signature",
+}
+
+// redactURL 認証情報および秘匿すべきクエリパラメータを伏字としたURL文字列を返す
+func redactURL(u *url.URL) string {
+	ru := *u
+	if ru.RawQuery != "" {
+		q := ru.Query()
+		redacted := false
+		for k := range q {
+			if slices.Contains(sensitiveQueryKeys, strings.ToLower(k)) {
+				q[k] = []string{"xxxxx"}
+				redacted = true
+			}
+		}
+		if redacted {
+			ru.RawQuery = q.Encode()
+		}
+	}
+	return ru.Redacted()
+}
+
+// NotAcceptableError デコード可能なメディアタイプ以外のレスポンスを受け取ったことを表すエラー
+//
+// Request.StrictAccept が有効な場合に返されます。errors.Is(err, ErrNotAcceptable) で判定できます。
+type NotAcceptableError struct {
+	response *http.Response
+
+	body   []byte
+	accept string
+}
+
+func newNotAcceptableError(response *http.Response, body []byte, accept string) error {
+	return &NotAcceptableError{response: response, body: body, accept: accept}
+}
+
+func (e *NotAcceptableError) Error() string {
+	return fmt.Sprintf("not acceptable: unexpected content type %q (accept %q)", e.response.Header.Get("Content-Type"), e.accept)
+}
+
+func (e *NotAcceptableError) Is(target error) bool {
+	return target == ErrNotAcceptable
+}
+
+// ContentType レスポンスのContent-Typeを返す
+func (e *NotAcceptableError) ContentType() string {
+	return e.response.Header.Get("Content-Type")
+}
+
+// Accept リクエストに付与したAcceptヘッダーの値を返す
+func (e *NotAcceptableError) Accept() string {
+	return e.accept
+}
+
+func (e *NotAcceptableError) StatusCode() int {
+	return e.response.StatusCode
+}
+
+func (e *NotAcceptableError) Body() []byte {
+	return e.body
+}
+
+// DecodedError エラーレスポンスのボディをデコードした値を保持するエラー
+//
+// Request.ErrorBody で指定された型の値(ポインタ)と、元となる *Error の双方を保持します。
+// デコードした値が error を実装している場合、errors.As により当該値と *Error の双方を取り出すことができます。
+type DecodedError struct {
+	err   *Error
+	value any
+}
+
+func newDecodedError(response *http.Response, body []byte, value any) error {
+	return &DecodedError{err: &Error{response: response, body: body}, value: value}
+}
+
+func (e *DecodedError) Error() string {
+	if err, ok := e.value.(error); ok {
+		return e.err.summary() + ": " + err.Error()
+	}
+	return e.err.Error()
+}
+
+func (e *DecodedError) Unwrap() []error {
+	if err, ok := e.value.(error); ok {
+		return []error{err, e.err}
+	}
+	return []error{e.err}
+}
+
+// Value デコードした値(ErrorBody で指定された型のポインタ)を返す
+func (e *DecodedError) Value() any {
+	return e.value
+}
+
+func (e *DecodedError) StatusCode() int {
+	return e.err.StatusCode()
+}
+
+func (e *DecodedError) Body() []byte {
+	return e.err.Body()
+}
+
+// ErrorBodyAs エラーに含まれるデコード済みのエラーボディを取り出す関数
+//
+// Eには Request.ErrorBody で指定した型のポインタを指定します。
+// error を実装しない型をエラーボディとした場合でも値を取り出すことができます。
+func ErrorBodyAs[E any](err error) (E, bool) {
+	var e *DecodedError
+	if errors.As(err, &e) {
+		v, ok := e.value.(E)
+		return v, ok
+	}
+	var zero E
+	return zero, false
+}
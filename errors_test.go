@@ -0,0 +1,172 @@
+package httpc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/codec"
+)
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func TestRequest_ErrorBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code":"invalid","message":"name is required"}`))
+	}))
+	defer s.Close()
+
+	_, err := httpc.NewRequest[map[string]any]().Codec(codec.JSON()).ErrorBody(&apiError{}).
+		Get(context.Background(), s.URL+"?type=application/json")
+	assert.ErrorContains(t, err, "400 Bad Request: invalid: name is required")
+
+	var ae *apiError
+	if assert.ErrorAs(t, err, &ae) {
+		assert.Equal(t, "invalid", ae.Code)
+	}
+	var e *httpc.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, http.StatusBadRequest, e.StatusCode())
+	}
+
+	type plain struct {
+		Code string `json:"code"`
+	}
+	_, err = httpc.NewRequest[map[string]any]().Codec(codec.JSON()).ErrorBody(plain{}).
+		Get(context.Background(), s.URL+"?type=application/json")
+	p, ok := httpc.ErrorBodyAs[*plain](err)
+	assert.True(t, ok)
+	assert.Equal(t, "invalid", p.Code)
+
+	_, err = httpc.NewRequest[map[string]any]().Codec(codec.JSON()).ErrorBody(&apiError{}).
+		Get(context.Background(), s.URL+"?type=text/plain")
+	assert.False(t, errors.As(err, &ae))
+	assert.ErrorAs(t, err, &e)
+}
+
+func TestRequest_ProblemDetails(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") == "xml" {
+			w.Header().Set("Content-Type", "application/problem+xml")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<problem xmlns="urn:ietf:rfc:7807">
+  <type>https://example.com/probs/out-of-credit</type>
+  <title>You do not have enough credit.</title>
+  <status>403</status>
+  <detail>Your current balance is 30, but that costs 50.</detail>
+  <instance>/account/12345/msgs/abc</instance>
+  <balance>30</balance>
+  <accounts><i>/account/12345</i><i>/account/67890</i></accounts>
+</problem>`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{
+  "type": "https://example.com/probs/out-of-credit",
+  "title": "You do not have enough credit.",
+  "status": 403,
+  "detail": "Your current balance is 30, but that costs 50.",
+  "instance": "/account/12345/msgs/abc",
+  "balance": 30,
+  "accounts": ["/account/12345", "/account/67890"]
+}`))
+	}))
+	defer s.Close()
+
+	for _, typ := range []string{"json", "xml"} {
+		t.Run(typ, func(t *testing.T) {
+			_, err := httpc.NewRequest[[]byte]().Get(context.Background(), s.URL+"?type="+typ)
+
+			var p *httpc.ProblemDetails
+			if assert.ErrorAs(t, err, &p) {
+				assert.Equal(t, "https://example.com/probs/out-of-credit", p.Type)
+				assert.Equal(t, "You do not have enough credit.", p.Title)
+				assert.Equal(t, http.StatusForbidden, p.Status)
+				assert.Equal(t, "Your current balance is 30, but that costs 50.", p.Detail)
+				assert.Equal(t, "/account/12345/msgs/abc", p.Instance)
+				assert.Contains(t, p.Extensions, "balance")
+				assert.Contains(t, p.Extensions, "accounts")
+			}
+			var e *httpc.Error
+			if assert.ErrorAs(t, err, &e) {
+				assert.Equal(t, http.StatusForbidden, e.StatusCode())
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.Header().Set("Retry-After", r.URL.Query().Get("retry_after"))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(strings.Repeat("error\n", 100)))
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	u.User = url.UserPassword("user", "password")
+	u.RawQuery = url.Values{"status": {"429"}, "retry_after": {"120"}, "access_token": {"secret-token"}}.Encode()
+
+	_, err := httpc.NewRequest[[]byte]().Get(context.Background(), u.String())
+	var e *httpc.Error
+	if !assert.ErrorAs(t, err, &e) {
+		return
+	}
+	assert.Equal(t, http.MethodGet, e.Method())
+	assert.NotContains(t, e.URL(), "password")
+	assert.NotContains(t, e.URL(), "secret-token")
+	assert.Contains(t, e.Error(), "GET http://user:xxxxx@")
+	assert.Contains(t, e.Error(), "429 Too Many Requests: error error")
+	assert.True(t, strings.HasSuffix(e.Error(), "..."))
+	assert.Equal(t, "120", e.Header().Get("Retry-After"))
+
+	assert.True(t, e.IsRetryable())
+	assert.True(t, e.IsClientError())
+	assert.False(t, e.IsServerError())
+	d, ok := e.RetryAfter()
+	assert.True(t, ok)
+	assert.Equal(t, 120*time.Second, d)
+
+	assert.ErrorIs(t, err, httpc.ErrRateLimited)
+	assert.ErrorIs(t, err, httpc.ErrClientError)
+	assert.NotErrorIs(t, err, httpc.ErrNotFound)
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	_, err = httpc.NewRequest[[]byte]().Get(context.Background(), s.URL+"?status=503&retry_after="+url.QueryEscape(date))
+	if assert.ErrorAs(t, err, &e) {
+		assert.True(t, e.IsServerError())
+		assert.ErrorIs(t, err, httpc.ErrServerError)
+		d, ok := e.RetryAfter()
+		assert.True(t, ok)
+		assert.InDelta(t, time.Hour, d, float64(5*time.Second))
+	}
+
+	_, err = httpc.NewRequest[[]byte]().Get(context.Background(), s.URL+"?status=404")
+	assert.ErrorIs(t, err, httpc.ErrNotFound)
+	if assert.ErrorAs(t, err, &e) {
+		assert.False(t, e.IsRetryable())
+		_, ok := e.RetryAfter()
+		assert.False(t, ok)
+	}
+}
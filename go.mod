@@ -3,13 +3,18 @@ module github.com/unvurn/httpc
 go 1.24.2
 
 require (
+	github.com/fxamacker/cbor/v2 v2.9.0
 	github.com/gorilla/schema v1.4.1
 	github.com/stretchr/testify v1.10.0
 	github.com/unvurn/core v0.1.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/net v0.48.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
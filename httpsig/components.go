@@ -0,0 +1,396 @@
+package httpsig
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// message 署名の対象となるHTTPメッセージ
+//
+// resがnilの場合はリクエスト、それ以外はレスポンス(reqは対応するリクエスト)を表します。
+type message struct {
+	req *http.Request
+	res *http.Response
+}
+
+// header メッセージのヘッダーを返す
+func (m message) header() http.Header {
+	if m.res != nil {
+		return m.res.Header
+	}
+	return m.req.Header
+}
+
+// component 署名の対象とするコンポーネント(RFC 9421 Section 2)
+type component struct {
+	name   string
+	params []param
+}
+
+// param 構造化フィールドのパラメータ
+type param struct {
+	key   string
+	value any // string, int64, bool もしくは token
+}
+
+// token 構造化フィールドのトークン(引用符なしで直列化する文字列)
+type token string
+
+// parseComponent "@query-param;name=\"id\"" 形式のコンポーネント識別子を解釈
+func parseComponent(s string) (component, error) {
+	name, rest, found := strings.Cut(s, ";")
+	var params []param
+	if found {
+		var err error
+		if params, err = parseParams(";" + rest); err != nil {
+			return component{}, err
+		}
+	}
+	return component{name: strings.ToLower(strings.TrimSpace(name)), params: params}, nil
+}
+
+// String コンポーネント識別子を直列化
+func (c component) String() string {
+	return strconv.Quote(c.name) + serializeParams(c.params)
+}
+
+func (c component) param(key string) (any, bool) {
+	for _, p := range c.params {
+		if p.key == key {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+// value メッセージにおけるコンポーネントの値を返す
+func (c component) value(m message) (string, error) {
+	if _, ok := c.param("req"); ok {
+		if m.res == nil {
+			return "", fmt.Errorf("httpsig: %s: req parameter is only valid for responses", c)
+		}
+		m = message{req: m.req}
+	}
+
+	if !strings.HasPrefix(c.name, "@") {
+		values := m.header().Values(c.name)
+		if len(values) == 0 {
+			return "", fmt.Errorf("httpsig: %s: header not present", c)
+		}
+		// Header.Values はヘッダー自身のスライスを返すため、複製して整形する
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.TrimSpace(v)
+		}
+		return strings.Join(trimmed, ", "), nil
+	}
+
+	if c.name == "@status" {
+		if m.res == nil {
+			return "", fmt.Errorf("httpsig: %s: only valid for responses", c)
+		}
+		return fmt.Sprintf("%03d", m.res.StatusCode), nil
+	}
+	if m.req == nil {
+		return "", fmt.Errorf("httpsig: %s: request not available", c)
+	}
+
+	req := m.req
+	switch c.name {
+	case "@method":
+		return strings.ToUpper(req.Method), nil
+	case "@target-uri":
+		return scheme(req) + "://" + authority(req) + req.URL.RequestURI(), nil
+	case "@authority":
+		return authority(req), nil
+	case "@scheme":
+		return scheme(req), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if p := req.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	case "@query-param":
+		name, _ := c.param("name")
+		n, ok := name.(string)
+		if !ok {
+			return "", fmt.Errorf("httpsig: %s: name parameter required", c)
+		}
+		values := req.URL.Query()[n]
+		if len(values) != 1 {
+			return "", fmt.Errorf("httpsig: %s: query parameter must appear exactly once", c)
+		}
+		return strings.ReplaceAll(url.QueryEscape(values[0]), "+", "%20"), nil
+	default:
+		return "", fmt.Errorf("httpsig: %s: unsupported derived component", c)
+	}
+}
+
+// scheme リクエストのスキームを返す
+func scheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return strings.ToLower(req.URL.Scheme)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// authority リクエストの対象ホスト(既定のポートを除く)を返す
+func authority(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if (port == "443" && scheme(req) == "https") || (port == "80" && scheme(req) == "http") {
+			if strings.Contains(h, ":") {
+				return "[" + h + "]"
+			}
+			return h
+		}
+	}
+	return host
+}
+
+// signatureBase 署名ベース(RFC 9421 Section 2.5)を生成
+//
+// paramsには "@signature-params" の値(内部リストとパラメータの直列化)を指定します。
+func signatureBase(m message, components []component, params string) ([]byte, error) {
+	var b strings.Builder
+	seen := map[string]bool{}
+	for _, c := range components {
+		id := c.String()
+		if seen[id] {
+			return nil, fmt.Errorf("httpsig: %s: duplicate component", id)
+		}
+		seen[id] = true
+
+		v, err := c.value(m)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(id + ": " + v + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + params)
+	return []byte(b.String()), nil
+}
+
+// serializeParams パラメータを直列化
+func serializeParams(params []param) string {
+	var b strings.Builder
+	for _, p := range params {
+		b.WriteString(";" + p.key)
+		switch v := p.value.(type) {
+		case bool:
+			if !v {
+				b.WriteString("=?0")
+			}
+		case int64:
+			b.WriteString("=" + strconv.FormatInt(v, 10))
+		case token:
+			b.WriteString("=" + string(v))
+		case string:
+			b.WriteString("=" + quoteString(v))
+		}
+	}
+	return b.String()
+}
+
+// quoteString 構造化フィールドの文字列として直列化
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// serializeInnerList コンポーネントの内部リストとパラメータを直列化
+func serializeInnerList(components []component, params []param) string {
+	ids := make([]string, len(components))
+	for i, c := range components {
+		ids[i] = c.String()
+	}
+	return "(" + strings.Join(ids, " ") + ")" + serializeParams(params)
+}
+
+// splitMembers 構造化フィールドの辞書・リストをメンバーごとに分割
+//
+// 引用符および括弧の内側のカンマでは分割しません。
+func splitMembers(s string) []string {
+	var members []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			members = append(members, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if m := strings.TrimSpace(s[start:]); m != "" {
+		members = append(members, m)
+	}
+	return members
+}
+
+// parseDictionary 構造化フィールドの辞書をキーと値(直列化したまま)の組として解釈
+func parseDictionary(s string) map[string]string {
+	d := map[string]string{}
+	for _, m := range splitMembers(s) {
+		k, v, ok := strings.Cut(m, "=")
+		if !ok {
+			v = "?1"
+		}
+		d[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return d
+}
+
+// parseByteSequence 構造化フィールドのバイト列(":base64:")を解釈
+func parseByteSequence(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != ':' || s[len(s)-1] != ':' {
+		return nil, errors.New("httpsig: invalid byte sequence")
+	}
+	return base64.StdEncoding.DecodeString(s[1 : len(s)-1])
+}
+
+// parseInnerList 構造化フィールドの内部リスト("(\"a\" \"b\");k=v")をコンポーネントとパラメータとして解釈
+func parseInnerList(s string) ([]component, []param, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		return nil, nil, errors.New("httpsig: invalid inner list")
+	}
+	s = s[1:]
+
+	var components []component
+	for {
+		s = strings.TrimLeft(s, " ")
+		if strings.HasPrefix(s, ")") {
+			s = s[1:]
+			break
+		}
+		if !strings.HasPrefix(s, `"`) {
+			return nil, nil, errors.New("httpsig: invalid inner list")
+		}
+		name, rest, err := cutString(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		end := itemEnd(rest)
+		params, err := parseParams(rest[:end])
+		if err != nil {
+			return nil, nil, err
+		}
+		components = append(components, component{name: name, params: params})
+		s = rest[end:]
+	}
+
+	params, err := parseParams(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return components, params, nil
+}
+
+// itemEnd 内部リストの要素のパラメータの終端(引用符の外側の空白もしくは ")")の位置を返す
+func itemEnd(s string) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == ' ' || c == ')'):
+			return i
+		}
+	}
+	return len(s)
+}
+
+// parseParams 構造化フィールドのパラメータ(";k=v;k2")を解釈
+func parseParams(s string) ([]param, error) {
+	var params []param
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] != ';' {
+			return nil, errors.New("httpsig: invalid parameters")
+		}
+		s = strings.TrimLeft(s[1:], " ")
+		i := strings.IndexAny(s, "=;")
+		if i < 0 || s[i] == ';' {
+			if i < 0 {
+				i = len(s)
+			}
+			params = append(params, param{key: s[:i], value: true})
+			s = s[i:]
+			continue
+		}
+
+		key, rest := s[:i], s[i+1:]
+		var value any
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			v, r, err := cutString(rest)
+			if err != nil {
+				return nil, err
+			}
+			value, rest = v, r
+		case strings.HasPrefix(rest, "?"):
+			value, rest = strings.HasPrefix(rest, "?1"), rest[min(2, len(rest)):]
+		default:
+			j := strings.IndexByte(rest, ';')
+			if j < 0 {
+				j = len(rest)
+			}
+			raw := strings.TrimSpace(rest[:j])
+			if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				value = n
+			} else {
+				value = token(raw)
+			}
+			rest = rest[j:]
+		}
+		params = append(params, param{key: key, value: value})
+		s = rest
+	}
+	return params, nil
+}
+
+// cutString 先頭の構造化フィールドの文字列を切り出す
+func cutString(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", errors.New("httpsig: invalid string")
+			}
+			i++
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", errors.New("httpsig: unterminated string")
+}
@@ -0,0 +1,94 @@
+package httpsig
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var ErrDigestMismatch = errors.New("httpsig: content digest mismatch")
+var ErrNoSupportedDigest = errors.New("httpsig: no supported content digest algorithm")
+
+// ダイジェストアルゴリズム(RFC 9530 Section 5)
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+)
+
+func digestHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case DigestSHA256:
+		return sha256.New
+	case DigestSHA512:
+		return sha512.New
+	default:
+		return nil
+	}
+}
+
+// ContentDigest ボディに対するContent-Digestヘッダー(RFC 9530)の値を返す
+//
+// algorithmには DigestSHA256 もしくは DigestSHA512 を指定します。
+func ContentDigest(algorithm string, body []byte) (string, error) {
+	newHash := digestHash(algorithm)
+	if newHash == nil {
+		return "", ErrNoSupportedDigest
+	}
+	h := newHash()
+	h.Write(body)
+	return algorithm + "=:" + base64.StdEncoding.EncodeToString(h.Sum(nil)) + ":", nil
+}
+
+// VerifyContentDigest Content-Digestヘッダーの値をボディに対して検証
+//
+// 対応するアルゴリズムのダイジェストがすべて一致することを確認します。
+// 対応するアルゴリズムのダイジェストが含まれない場合は ErrNoSupportedDigest を返します。
+func VerifyContentDigest(value string, body []byte) error {
+	verified := false
+	for _, member := range splitMembers(value) {
+		algorithm, encoded, ok := strings.Cut(member, "=")
+		if !ok {
+			continue
+		}
+		newHash := digestHash(strings.ToLower(strings.TrimSpace(algorithm)))
+		if newHash == nil {
+			continue
+		}
+		expected, err := parseByteSequence(encoded)
+		if err != nil {
+			return err
+		}
+		h := newHash()
+		h.Write(body)
+		if subtle.ConstantTimeCompare(h.Sum(nil), expected) != 1 {
+			return ErrDigestMismatch
+		}
+		verified = true
+	}
+	if !verified {
+		return ErrNoSupportedDigest
+	}
+	return nil
+}
+
+// readBody リクエストのボディを http.Request.GetBody により再取得して読み込む
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("httpsig: request body must be replayable to compute content digest")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+	return io.ReadAll(body)
+}
@@ -0,0 +1,408 @@
+// Package httpsig HTTPメッセージ署名(RFC 9421)とContent-Digest(RFC 9530)
+//
+// Signer は httpc.Auth を実装しており、Request.Auth もしくは Client.Auth に指定することで
+// 各リクエストに Signature-Input, Signature ヘッダー(および必要に応じて Content-Digest ヘッダー)を付与します。
+// 他のAuth(Bearerトークン等)と併用する場合は、Signer.Middleware を Request.Use もしくは Client.Use に指定します。
+// Verifier は署名されたレスポンス(もしくはリクエスト)を検証し、Verifier.Middleware によりレスポンスの検証を
+// リクエストの処理に組み込むことができます。
+//
+// 署名アルゴリズムは hmac-sha256, ed25519, ecdsa-p256-sha256, rsa-pss-sha512 に対応します。
+//
+//	signer := httpsig.NewSigner("key-1", httpsig.Ed25519PrivateKey(priv))
+//	c := httpc.NewClient().Auth(signer)
+//
+//	// Authorizationヘッダーを含めて署名する
+//	c = httpc.NewClient().Auth(httpc.BearerAuth(token)).
+//		Use(httpsig.NewSigner("key-1", key).Components("@method", "@target-uri", "authorization").Middleware())
+package httpsig
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/unvurn/httpc"
+)
+
+// Signer HTTPメッセージに署名するAuth
+//
+// 既定では "@method", "@target-uri" と、ボディを持つリクエストでは "content-type"(存在する場合), "content-digest" を署名の対象とし、
+// created, keyid パラメータを付与します。"content-digest" を署名の対象とし、ヘッダーが存在しない場合は、
+// ボディ(http.Request.GetBody により再取得)から算出して付与します。
+// Signer は設定後に複数のgoroutineから共有できます。
+type Signer struct {
+	keyID      string
+	key        SigningKey
+	label      string
+	components []component
+	expires    time.Duration
+	nonce      func() string
+	tag        string
+	alg        bool
+	digest     string
+}
+
+// NewSigner Signerを生成する関数
+func NewSigner(keyID string, key SigningKey) *Signer {
+	return &Signer{
+		keyID:  keyID,
+		key:    key,
+		label:  "sig1",
+		digest: DigestSHA256,
+	}
+}
+
+// Components 署名の対象とするコンポーネントを設定
+//
+// ヘッダー名(小文字)もしくは "@method", "@target-uri", "@authority", "@scheme", "@request-target",
+// "@path", "@query", "@status" 等の派生コンポーネントを指定します。パラメータは `@query-param;name="id"`、
+// `content-type;req` のように指定します。不正な識別子の場合はpanicします。
+func (s *Signer) Components(components ...string) *Signer {
+	s.components = make([]component, len(components))
+	for i, c := range components {
+		cc, err := parseComponent(c)
+		if err != nil {
+			panic(err)
+		}
+		s.components[i] = cc
+	}
+	return s
+}
+
+// Label 署名のラベルを設定
+//
+// 既定では "sig1" です。
+func (s *Signer) Label(label string) *Signer {
+	s.label = label
+	return s
+}
+
+// Expires 署名の有効期間を設定し、expires パラメータを付与する
+func (s *Signer) Expires(d time.Duration) *Signer {
+	s.expires = d
+	return s
+}
+
+// Nonce nonce パラメータを生成する関数を設定
+func (s *Signer) Nonce(f func() string) *Signer {
+	s.nonce = f
+	return s
+}
+
+// Tag tag パラメータを設定
+func (s *Signer) Tag(tag string) *Signer {
+	s.tag = tag
+	return s
+}
+
+// IncludeAlgorithm alg パラメータを付与するかを設定
+func (s *Signer) IncludeAlgorithm(include bool) *Signer {
+	s.alg = include
+	return s
+}
+
+// DigestAlgorithm Content-Digestヘッダーを算出するアルゴリズムを設定
+//
+// 既定では DigestSHA256 です。
+func (s *Signer) DigestAlgorithm(algorithm string) *Signer {
+	s.digest = algorithm
+	return s
+}
+
+// Apply 現在時刻によりリクエストに署名する(httpc.Auth の実装)
+func (s *Signer) Apply(req *http.Request) error {
+	return s.Sign(req, time.Now())
+}
+
+// Sign 指定した時刻によりリクエストに署名する
+func (s *Signer) Sign(req *http.Request, t time.Time) error {
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	components := s.components
+	if components == nil {
+		components = []component{{name: "@method"}, {name: "@target-uri"}}
+		if hasBody {
+			if req.Header.Get("Content-Type") != "" {
+				components = append(components, component{name: "content-type"})
+			}
+			components = append(components, component{name: "content-digest"})
+		}
+	}
+
+	if s.covers(components, "content-digest") && req.Header.Get("Content-Digest") == "" {
+		body, err := readBody(req)
+		if err != nil {
+			return err
+		}
+		d, err := ContentDigest(s.digest, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Digest", d)
+	}
+	return s.sign(message{req: req}, components, t)
+}
+
+// Middleware 現在時刻によりリクエストに署名する httpc.Middleware を返す
+//
+// ミドルウェアはAuthの適用後に呼び出されるため、Authが付与したヘッダー(Authorization 等)も署名の対象にできます。
+// 署名は試行ごとに行い、呼び出し元のリクエストは変更しません。
+func (s *Signer) Middleware() httpc.Middleware {
+	return func(next httpc.Handler) httpc.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			if err := s.Apply(req); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}
+}
+
+// SignResponse 指定した時刻によりレスポンスに署名する
+//
+// bodyはレスポンスのボディで、"content-digest" を署名の対象とする場合に使用します。
+// ";req" パラメータを付与したコンポーネントは res.Request から取得します。
+// 既定では "@status" と、"content-type"(存在する場合), "content-digest" を署名の対象とします。
+func (s *Signer) SignResponse(res *http.Response, body []byte, t time.Time) error {
+	components := s.components
+	if components == nil {
+		components = []component{{name: "@status"}}
+		if res.Header.Get("Content-Type") != "" {
+			components = append(components, component{name: "content-type"})
+		}
+		components = append(components, component{name: "content-digest"})
+	}
+
+	if s.covers(components, "content-digest") && res.Header.Get("Content-Digest") == "" {
+		d, err := ContentDigest(s.digest, body)
+		if err != nil {
+			return err
+		}
+		res.Header.Set("Content-Digest", d)
+	}
+	return s.sign(message{req: res.Request, res: res}, components, t)
+}
+
+// covers ヘッダーがメッセージ自身のコンポーネントとして署名の対象であるかを返す
+func (s *Signer) covers(components []component, name string) bool {
+	return slices.ContainsFunc(components, func(c component) bool {
+		_, req := c.param("req")
+		return c.name == name && !req
+	})
+}
+
+func (s *Signer) sign(m message, components []component, t time.Time) error {
+	params := []param{{key: "created", value: t.Unix()}}
+	if s.expires > 0 {
+		params = append(params, param{key: "expires", value: t.Add(s.expires).Unix()})
+	}
+	if s.nonce != nil {
+		params = append(params, param{key: "nonce", value: s.nonce()})
+	}
+	if s.alg {
+		params = append(params, param{key: "alg", value: s.key.Algorithm()})
+	}
+	params = append(params, param{key: "keyid", value: s.keyID})
+	if s.tag != "" {
+		params = append(params, param{key: "tag", value: s.tag})
+	}
+
+	input := serializeInnerList(components, params)
+	base, err := signatureBase(m, components, input)
+	if err != nil {
+		return err
+	}
+	sig, err := s.key.Sign(base)
+	if err != nil {
+		return err
+	}
+
+	h := m.header()
+	h.Add("Signature-Input", s.label+"="+input)
+	h.Add("Signature", s.label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// Verifier HTTPメッセージの署名を検証する構造体
+//
+// 署名の keyid パラメータから検証鍵を取得し、署名ベースを再構成して検証します。
+// Content-Digestヘッダーが署名の対象に含まれる場合は、ボディに対するダイジェストも検証します。
+type Verifier struct {
+	keys     func(keyID string) (VerifyingKey, error)
+	label    string
+	required []component
+	maxAge   time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier Verifierを生成する関数
+//
+// keysには keyid パラメータに対応する検証鍵を返す関数を指定します。
+func NewVerifier(keys func(keyID string) (VerifyingKey, error)) *Verifier {
+	return &Verifier{keys: keys, now: time.Now}
+}
+
+// Label 検証する署名のラベルを設定
+//
+// 未指定の場合は、メッセージに含まれるいずれかの署名が検証に成功すれば成功とみなします。
+func (v *Verifier) Label(label string) *Verifier {
+	v.label = label
+	return v
+}
+
+// Require 署名の対象に含まれていなければならないコンポーネントを設定
+//
+// 識別子の形式は Signer.Components と同じです。不正な識別子の場合はpanicします。
+func (v *Verifier) Require(components ...string) *Verifier {
+	v.required = make([]component, len(components))
+	for i, c := range components {
+		cc, err := parseComponent(c)
+		if err != nil {
+			panic(err)
+		}
+		v.required[i] = cc
+	}
+	return v
+}
+
+// MaxAge created パラメータからの経過時間の上限を設定
+//
+// 0の場合は created パラメータを検証しません。expires パラメータは常に検証します。
+func (v *Verifier) MaxAge(d time.Duration) *Verifier {
+	v.maxAge = d
+	return v
+}
+
+// VerifyRequest リクエストの署名を検証
+//
+// bodyはリクエストのボディで、Content-Digestヘッダーの検証に使用します。
+func (v *Verifier) VerifyRequest(req *http.Request, body []byte) error {
+	return v.verify(message{req: req}, body)
+}
+
+// VerifyResponse レスポンスの署名を検証
+//
+// bodyはレスポンスのボディで、Content-Digestヘッダーの検証に使用します。
+// ";req" パラメータを付与したコンポーネントは res.Request から取得します。
+func (v *Verifier) VerifyResponse(res *http.Response, body []byte) error {
+	return v.verify(message{req: res.Request, res: res}, body)
+}
+
+// Middleware レスポンスの署名を検証する httpc.Middleware を返す
+//
+// 検証に失敗した場合はレスポンスを破棄してエラーを返します。
+func (v *Verifier) Middleware() httpc.Middleware {
+	return func(next httpc.Handler) httpc.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			res, err := next(req)
+			if err != nil {
+				return nil, err
+			}
+			body, err := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			if err := v.VerifyResponse(res, body); err != nil {
+				return nil, err
+			}
+			res.Body = io.NopCloser(bytes.NewReader(body))
+			return res, nil
+		}
+	}
+}
+
+func (v *Verifier) verify(m message, body []byte) error {
+	inputs := parseDictionary(strings.Join(m.header().Values("Signature-Input"), ", "))
+	signatures := parseDictionary(strings.Join(m.header().Values("Signature"), ", "))
+	if len(inputs) == 0 {
+		return ErrNoSignature
+	}
+
+	var lastErr error
+	for label, input := range inputs {
+		if v.label != "" && label != v.label {
+			continue
+		}
+		sig, ok := signatures[label]
+		if !ok {
+			lastErr = fmt.Errorf("httpsig: %s: signature not present", label)
+			continue
+		}
+		if lastErr = v.verifySignature(m, input, sig, body); lastErr == nil {
+			return nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("httpsig: %s: signature not present", v.label)
+	}
+	return lastErr
+}
+
+func (v *Verifier) verifySignature(m message, input, sig string, body []byte) error {
+	components, params, err := parseInnerList(input)
+	if err != nil {
+		return err
+	}
+	for _, r := range v.required {
+		if !slices.ContainsFunc(components, func(c component) bool { return c.String() == r.String() }) {
+			return fmt.Errorf("httpsig: required component %s not covered", r)
+		}
+	}
+
+	var keyID, alg string
+	var created, expires int64
+	for _, p := range params {
+		switch p.key {
+		case "keyid":
+			keyID, _ = p.value.(string)
+		case "alg":
+			alg, _ = p.value.(string)
+		case "created":
+			created, _ = p.value.(int64)
+		case "expires":
+			expires, _ = p.value.(int64)
+		}
+	}
+	now := v.now()
+	if expires != 0 && now.Unix() > expires {
+		return ErrSignatureExpired
+	}
+	if v.maxAge > 0 && (created == 0 || now.Sub(time.Unix(created, 0)) > v.maxAge) {
+		return ErrSignatureExpired
+	}
+
+	key, err := v.keys(keyID)
+	if err != nil {
+		return err
+	}
+	if alg != "" && alg != key.Algorithm() {
+		return fmt.Errorf("httpsig: algorithm mismatch: %s", alg)
+	}
+
+	// "@signature-params" には受け取った値をそのまま用いる
+	base, err := signatureBase(m, components, strings.TrimSpace(input))
+	if err != nil {
+		return err
+	}
+	signature, err := parseByteSequence(sig)
+	if err != nil {
+		return err
+	}
+	if err := key.Verify(base, signature); err != nil {
+		return err
+	}
+
+	if slices.ContainsFunc(components, func(c component) bool {
+		_, req := c.param("req")
+		return c.name == "content-digest" && !req
+	}) {
+		return VerifyContentDigest(m.header().Get("Content-Digest"), body)
+	}
+	return nil
+}
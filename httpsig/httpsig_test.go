@@ -0,0 +1,235 @@
+package httpsig_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/httpsig"
+)
+
+// RFC 9421 Appendix B.2 のリクエスト
+func exampleRequest() *http.Request {
+	body := `{"hello": "world"}`
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/foo?param=Value&Pet=dog", strings.NewReader(body))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	req.Header.Set("Content-Length", "18")
+	return req
+}
+
+var exampleTime = time.Unix(1618884473, 0)
+
+func TestContentDigest(t *testing.T) {
+	// RFC 9530 Appendix B の例
+	body := []byte(`{"hello": "world"}`)
+	d, err := httpsig.ContentDigest(httpsig.DigestSHA256, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", d)
+
+	d, err = httpsig.ContentDigest(httpsig.DigestSHA512, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:", d)
+
+	_, err = httpsig.ContentDigest("md5", body)
+	assert.ErrorIs(t, err, httpsig.ErrNoSupportedDigest)
+
+	assert.NoError(t, httpsig.VerifyContentDigest("unknown=:AA==:, sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", body))
+	assert.ErrorIs(t, httpsig.VerifyContentDigest("sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", []byte("{}")), httpsig.ErrDigestMismatch)
+	assert.ErrorIs(t, httpsig.VerifyContentDigest("md5=:AA==:", body), httpsig.ErrNoSupportedDigest)
+}
+
+func TestSigner_Sign_HMAC(t *testing.T) {
+	// RFC 9421 Appendix B.2.5 の例
+	key, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	req := exampleRequest()
+
+	s := httpsig.NewSigner("test-shared-secret", httpsig.HMACSHA256(key)).
+		Label("sig-b25").
+		Components("date", "@authority", "content-type")
+	assert.NoError(t, s.Sign(req, exampleTime))
+	assert.Equal(t, `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`, req.Header.Get("Signature-Input"))
+	assert.Equal(t, "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:", req.Header.Get("Signature"))
+
+	v := httpsig.NewVerifier(func(keyID string) (httpsig.VerifyingKey, error) {
+		assert.Equal(t, "test-shared-secret", keyID)
+		return httpsig.HMACSHA256(key), nil
+	})
+	assert.NoError(t, v.VerifyRequest(req, nil))
+
+	// 署名の対象のヘッダーが改変された場合は検証に失敗する
+	req.Header.Set("Content-Type", "text/plain")
+	assert.ErrorIs(t, v.VerifyRequest(req, nil), httpsig.ErrInvalidSignature)
+}
+
+func TestSigner_Sign_HeaderUnchanged(t *testing.T) {
+	req := exampleRequest()
+	req.Header["X-Padded"] = []string{"  a ", "b  "}
+
+	s := httpsig.NewSigner("key", httpsig.HMACSHA256("secret")).Components("x-padded")
+	assert.NoError(t, s.Sign(req, exampleTime))
+	// 署名ベースの整形によりヘッダーの値を変更しない
+	assert.Equal(t, []string{"  a ", "b  "}, req.Header["X-Padded"])
+
+	v := httpsig.NewVerifier(func(string) (httpsig.VerifyingKey, error) { return httpsig.HMACSHA256("secret"), nil })
+	assert.NoError(t, v.VerifyRequest(req, nil))
+	assert.Equal(t, []string{"  a ", "b  "}, req.Header["X-Padded"])
+}
+
+func TestSigner_Sign_Ed25519(t *testing.T) {
+	// RFC 9421 Appendix B.2.6 の例
+	der, _ := base64.StdEncoding.DecodeString("MC4CAQAwBQYDK2VwBCIEIJ+DYvh6SEqVTm50DFtMDoQikTmiCqirVv9mWG9qfSnF")
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	assert.NoError(t, err)
+	req := exampleRequest()
+
+	s := httpsig.NewSigner("test-key-ed25519", httpsig.Ed25519PrivateKey(priv.(ed25519.PrivateKey))).
+		Label("sig-b26").
+		Components("date", "@method", "@path", "@authority", "content-type", "content-length")
+	assert.NoError(t, s.Sign(req, exampleTime))
+	assert.Equal(t, `sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`, req.Header.Get("Signature-Input"))
+	assert.Equal(t, "sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:", req.Header.Get("Signature"))
+
+	pub := httpsig.Ed25519PublicKey(priv.(ed25519.PrivateKey).Public().(ed25519.PublicKey))
+	v := httpsig.NewVerifier(func(string) (httpsig.VerifyingKey, error) { return pub, nil }).Label("sig-b26")
+	assert.NoError(t, v.VerifyRequest(req, nil))
+}
+
+func TestVerifier_VerifyRequest(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys := map[string]struct {
+		signing   httpsig.SigningKey
+		verifying httpsig.VerifyingKey
+	}{
+		"ecdsa": {httpsig.ECDSAP256PrivateKey{PrivateKey: ecKey}, httpsig.ECDSAP256PublicKey{PublicKey: &ecKey.PublicKey}},
+		"rsa":   {httpsig.RSAPSSPrivateKey{PrivateKey: rsaKey}, httpsig.RSAPSSPublicKey{PublicKey: &rsaKey.PublicKey}},
+	}
+
+	var verifyErr error
+	v := httpsig.NewVerifier(func(keyID string) (httpsig.VerifyingKey, error) {
+		k, ok := keys[keyID]
+		if !ok {
+			return nil, errors.New("unknown key")
+		}
+		return k.verifying, nil
+	}).Require("@method", "content-digest").MaxAge(time.Minute)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = v.VerifyRequest(r, body)
+	}))
+	defer s.Close()
+
+	for keyID, k := range keys {
+		signer := httpsig.NewSigner(keyID, k.signing).IncludeAlgorithm(true).Expires(time.Minute)
+		_, err := httpc.NewRequest[[]byte]().Auth(signer).
+			Encoder("text/plain", func(v any) (io.Reader, error) {
+				return strings.NewReader(v.(string)), nil
+			}).
+			TryPost(context.Background(), s.URL+"/items?id=1", "hello")
+		assert.NoError(t, err)
+		assert.NoError(t, verifyErr, keyID)
+	}
+
+	// 署名のないリクエスト
+	_, err := httpc.NewRequest[[]byte]().TryGet(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, verifyErr, httpsig.ErrNoSignature)
+}
+
+func TestSigner_Middleware(t *testing.T) {
+	key := httpsig.HMACSHA256("request-secret")
+	v := httpsig.NewVerifier(func(string) (httpsig.VerifyingKey, error) { return key, nil }).
+		Require("@method", "authorization", "content-digest")
+
+	var verifyErr error
+	var authorization string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = v.VerifyRequest(r, body)
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer s.Close()
+
+	// Authが付与したAuthorizationヘッダーを含めて署名する
+	signer := httpsig.NewSigner("client", key).Components("@method", "@target-uri", "authorization", "content-digest")
+	c := httpc.NewClient().Auth(httpc.BearerAuth("token")).Use(signer.Middleware())
+	_, err := httpc.NewRequestFrom[[]byte](c).
+		Encoder("text/plain", func(v any) (io.Reader, error) {
+			return strings.NewReader(v.(string)), nil
+		}).
+		TryPost(context.Background(), s.URL+"/items", "hello")
+	assert.NoError(t, err)
+	assert.NoError(t, verifyErr)
+	assert.Equal(t, "Bearer token", authorization)
+
+	// 署名後にAuthorizationヘッダーを変更したリクエストは検証に失敗する
+	tampered := func(next httpc.Handler) httpc.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("Authorization", "Bearer other")
+			return next(req)
+		}
+	}
+	c = httpc.NewClient().Auth(httpc.BearerAuth("token")).Use(signer.Middleware(), tampered)
+	_, err = httpc.NewRequestFrom[[]byte](c).TryGet(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Error(t, verifyErr)
+}
+
+func TestVerifier_Expired(t *testing.T) {
+	key := httpsig.HMACSHA256("secret")
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	assert.NoError(t, httpsig.NewSigner("k", key).Expires(time.Minute).Sign(req, time.Now().Add(-time.Hour)))
+
+	v := httpsig.NewVerifier(func(string) (httpsig.VerifyingKey, error) { return key, nil })
+	assert.ErrorIs(t, v.VerifyRequest(req, nil), httpsig.ErrSignatureExpired)
+}
+
+func TestVerifier_Middleware(t *testing.T) {
+	key := httpsig.HMACSHA256("response-secret")
+	signer := httpsig.NewSigner("server", key).Components("@status", "content-type", "content-digest", "@method;req")
+	tamper := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := []byte("signed response")
+		res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: r}
+		res.Header.Set("Content-Type", "text/plain")
+		_ = signer.SignResponse(res, body, time.Now())
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		if tamper {
+			body = []byte("tampered response")
+		}
+		_, _ = w.Write(body)
+	}))
+	defer s.Close()
+
+	v := httpsig.NewVerifier(func(string) (httpsig.VerifyingKey, error) { return key, nil })
+	r := httpc.NewRequest[[]byte]().Header("Accept", "text/plain").Use(v.Middleware())
+
+	res, err := r.TryGet(context.Background(), s.URL)
+	assert.NoError(t, err)
+	var body []byte
+	assert.NoError(t, res.As(&body))
+	assert.Equal(t, "signed response", string(body))
+
+	tamper = true
+	_, err = r.TryGet(context.Background(), s.URL)
+	assert.ErrorIs(t, err, httpsig.ErrDigestMismatch)
+}
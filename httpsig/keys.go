@@ -0,0 +1,169 @@
+package httpsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+)
+
+var ErrInvalidSignature = errors.New("httpsig: invalid signature")
+var ErrNoSignature = errors.New("httpsig: no signature")
+var ErrSignatureExpired = errors.New("httpsig: signature expired")
+
+// 署名アルゴリズム(RFC 9421 Section 6.2.2)
+const (
+	AlgorithmHMACSHA256      = "hmac-sha256"
+	AlgorithmEd25519         = "ed25519"
+	AlgorithmECDSAP256SHA256 = "ecdsa-p256-sha256"
+	AlgorithmRSAPSSSHA512    = "rsa-pss-sha512"
+)
+
+// SigningKey 署名ベースに署名する鍵
+type SigningKey interface {
+	Algorithm() string
+	Sign(base []byte) ([]byte, error)
+}
+
+// VerifyingKey 署名ベースに対する署名を検証する鍵
+type VerifyingKey interface {
+	Algorithm() string
+	Verify(base, signature []byte) error
+}
+
+// HMACSHA256 HMAC-SHA256 の共有鍵
+//
+// SigningKey と VerifyingKey の双方を実装します。
+type HMACSHA256 []byte
+
+func (k HMACSHA256) Algorithm() string {
+	return AlgorithmHMACSHA256
+}
+
+func (k HMACSHA256) Sign(base []byte) ([]byte, error) {
+	h := hmac.New(sha256.New, k)
+	h.Write(base)
+	return h.Sum(nil), nil
+}
+
+func (k HMACSHA256) Verify(base, signature []byte) error {
+	expected, _ := k.Sign(base)
+	if !hmac.Equal(expected, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Ed25519PrivateKey Ed25519 の署名鍵
+type Ed25519PrivateKey ed25519.PrivateKey
+
+func (k Ed25519PrivateKey) Algorithm() string {
+	return AlgorithmEd25519
+}
+
+func (k Ed25519PrivateKey) Sign(base []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(k), base), nil
+}
+
+// Ed25519PublicKey Ed25519 の検証鍵
+type Ed25519PublicKey ed25519.PublicKey
+
+func (k Ed25519PublicKey) Algorithm() string {
+	return AlgorithmEd25519
+}
+
+func (k Ed25519PublicKey) Verify(base, signature []byte) error {
+	if !ed25519.Verify(ed25519.PublicKey(k), base, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ECDSAP256PrivateKey ECDSA (P-256, SHA-256) の署名鍵
+//
+// 署名はr, sをそれぞれ32バイトのビッグエンディアンとして連結した64バイトの値です。
+type ECDSAP256PrivateKey struct {
+	*ecdsa.PrivateKey
+}
+
+func (k ECDSAP256PrivateKey) Algorithm() string {
+	return AlgorithmECDSAP256SHA256
+}
+
+func (k ECDSAP256PrivateKey) Sign(base []byte) ([]byte, error) {
+	if k.Curve != elliptic.P256() {
+		return nil, errors.New("httpsig: ecdsa-p256-sha256 requires a P-256 key")
+	}
+	digest := sha256.Sum256(base)
+	r, s, err := ecdsa.Sign(rand.Reader, k.PrivateKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// ECDSAP256PublicKey ECDSA (P-256, SHA-256) の検証鍵
+type ECDSAP256PublicKey struct {
+	*ecdsa.PublicKey
+}
+
+func (k ECDSAP256PublicKey) Algorithm() string {
+	return AlgorithmECDSAP256SHA256
+}
+
+func (k ECDSAP256PublicKey) Verify(base, signature []byte) error {
+	if len(signature) != 64 {
+		return ErrInvalidSignature
+	}
+	digest := sha256.Sum256(base)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(k.PublicKey, digest[:], r, s) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// pssOptions RSASSA-PSS (SHA-512, ソルト長64バイト)のパラメータ
+var pssOptions = &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512}
+
+// RSAPSSPrivateKey RSASSA-PSS (SHA-512) の署名鍵
+type RSAPSSPrivateKey struct {
+	*rsa.PrivateKey
+}
+
+func (k RSAPSSPrivateKey) Algorithm() string {
+	return AlgorithmRSAPSSSHA512
+}
+
+func (k RSAPSSPrivateKey) Sign(base []byte) ([]byte, error) {
+	digest := sha512.Sum512(base)
+	return rsa.SignPSS(rand.Reader, k.PrivateKey, crypto.SHA512, digest[:], pssOptions)
+}
+
+// RSAPSSPublicKey RSASSA-PSS (SHA-512) の検証鍵
+type RSAPSSPublicKey struct {
+	*rsa.PublicKey
+}
+
+func (k RSAPSSPublicKey) Algorithm() string {
+	return AlgorithmRSAPSSSHA512
+}
+
+func (k RSAPSSPublicKey) Verify(base, signature []byte) error {
+	digest := sha512.Sum512(base)
+	if err := rsa.VerifyPSS(k.PublicKey, crypto.SHA512, digest[:], signature, pssOptions); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package httpc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// DefaultIdempotencyKeyHeader べき等キーを付与する既定のヘッダー名
+const DefaultIdempotencyKeyHeader = "Idempotency-Key"
+
+// NewIdempotencyKey べき等キーとしてUUID(バージョン4)を生成する関数
+//
+// Request.IdempotencyKeyFunc が指定されていない場合に使用されます。
+func NewIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// requiresIdempotencyKey べき等キーを付与する対象のメソッドであるかを返す
+func requiresIdempotencyKey(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch
+}
@@ -0,0 +1,266 @@
+package httpc
+
+import (
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MediaType メディアタイプ(RFC 9110 Section 8.3.1)
+//
+// Content-Typeヘッダーの値や、デコーダー登録時に指定するメディアレンジ("*/*", "application/*" 等)を表します。
+// Type, Subtype は小文字に正規化されます。
+type MediaType struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+}
+
+// ParseMediaType 文字列をメディアタイプとして解釈
+//
+// 空文字列はゼロ値のMediaType(Content-Type未指定を表す)として扱います。
+func ParseMediaType(s string) (MediaType, error) {
+	if strings.TrimSpace(s) == "" {
+		return MediaType{}, nil
+	}
+	v, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return MediaType{}, err
+	}
+	t, st, _ := strings.Cut(v, "/")
+	return MediaType{Type: t, Subtype: st, Params: params}, nil
+}
+
+// parseContentType Content-Typeヘッダーの値をメディアタイプとして解釈
+//
+// パラメータが不正な場合でもメディアタイプ部分のみを解釈して返します。
+func parseContentType(value string) MediaType {
+	mt, err := ParseMediaType(value)
+	if err == nil {
+		return mt
+	}
+	v := strings.ToLower(strings.TrimSpace(strings.Split(value, ";")[0]))
+	t, st, _ := strings.Cut(v, "/")
+	return MediaType{Type: t, Subtype: st}
+}
+
+// String メディアタイプを文字列として返す
+func (m MediaType) String() string {
+	if m.IsZero() {
+		return ""
+	}
+	return mime.FormatMediaType(m.Essence(), m.Params)
+}
+
+// Essence パラメータを除いた "type/subtype" を返す
+func (m MediaType) Essence() string {
+	if m.IsZero() {
+		return ""
+	}
+	return m.Type + "/" + m.Subtype
+}
+
+// IsZero メディアタイプが未指定かを返す
+func (m MediaType) IsZero() bool {
+	return m.Type == "" && m.Subtype == ""
+}
+
+// Suffix 構造化構文サフィックス(RFC 6838 Section 4.2.8)を返す
+//
+// 例えば "application/problem+json" に対しては "json" を返します。サフィックスがない場合は空文字列を返します。
+func (m MediaType) Suffix() string {
+	if i := strings.LastIndexByte(m.Subtype, '+'); i >= 0 {
+		return m.Subtype[i+1:]
+	}
+	return ""
+}
+
+// Charset charsetパラメータを返す
+func (m MediaType) Charset() string {
+	return m.Params["charset"]
+}
+
+// quality qパラメータ(RFC 9110 Section 12.4.2)を返す
+//
+// 未指定もしくは不正な値の場合は1を返します。
+func (m MediaType) quality() float64 {
+	s, ok := m.Params["q"]
+	if !ok {
+		return 1
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil || q < 0 || q > 1 {
+		return 1
+	}
+	return q
+}
+
+// メディアレンジとの一致の度合い
+//
+// 値が大きいほど具体的な一致を表します。
+const (
+	matchNone = iota
+	matchAny
+	matchType
+	matchSuffix
+	matchExact
+)
+
+// match メディアタイプがメディアレンジrに一致する度合いを返す
+//
+// 一致の度合いは以下の順に具体的とみなします。
+//   - matchExact: "type/subtype" が完全に一致
+//   - matchSuffix: "application/*+json" のようなサフィックス指定、もしくは "application/json" が "application/problem+json" に一致
+//   - matchType: "application/*" のようなサブタイプのワイルドカード
+//   - matchAny: "*/*"
+//
+// rにq以外のパラメータが指定されている場合、それらがすべて一致しなければ一致とみなしません。
+// 第2返値は一致したパラメータの数です。
+func (m MediaType) match(r MediaType) (int, int) {
+	if r.IsZero() {
+		if m.IsZero() {
+			return matchExact, 0
+		}
+		return matchNone, 0
+	}
+
+	params := 0
+	for k, v := range r.Params {
+		if k == "q" {
+			continue
+		}
+		if !strings.EqualFold(m.Params[k], v) {
+			return matchNone, 0
+		}
+		params++
+	}
+
+	if r.Type == "*" {
+		return matchAny, params
+	}
+	if r.Type != m.Type {
+		return matchNone, 0
+	}
+	if r.Subtype == "*" {
+		return matchType, params
+	}
+	if suffix, ok := strings.CutPrefix(r.Subtype, "*+"); ok {
+		if m.Suffix() == suffix {
+			return matchSuffix, params
+		}
+		return matchNone, 0
+	}
+	if r.Subtype == m.Subtype {
+		return matchExact, params
+	}
+	if r.Suffix() == "" && m.Suffix() == r.Subtype {
+		return matchSuffix, params
+	}
+	return matchNone, 0
+}
+
+// mediaEntry メディアレンジに紐づけられた値
+type mediaEntry[V any] struct {
+	mediaRange MediaType
+	value      V
+}
+
+// mediaEntries メディアレンジをキーとする値の集合
+//
+// 登録順を保持し、同じメディアレンジに対する再登録は値を置き換えます。
+type mediaEntries[V any] []mediaEntry[V]
+
+// set メディアレンジに値を紐づける
+//
+// メディアレンジとして解釈できない文字列が指定された場合はpanicします。
+func (es mediaEntries[V]) set(mediaRange string, v V) mediaEntries[V] {
+	r, err := ParseMediaType(mediaRange)
+	if err != nil {
+		panic("invalid media range: " + mediaRange)
+	}
+	for i, e := range es {
+		if e.mediaRange.String() == r.String() {
+			es[i].value = v
+			return es
+		}
+	}
+	return append(es, mediaEntry[V]{mediaRange: r, value: v})
+}
+
+// negotiate メディアタイプに最も適合する値を返す
+//
+// 一致の度合い、一致したパラメータの数、qパラメータの順に比較し、いずれも等しい場合は先に登録されたものを優先します。
+// 第3返値は一致の度合いで、一致するものがない場合は matchNone となります。
+func (es mediaEntries[V]) negotiate(mt MediaType) (V, MediaType, int) {
+	var best V
+	var bestRange MediaType
+	bestLevel, bestParams, bestQ := matchNone, 0, 0.0
+
+	for _, e := range es {
+		level, params := mt.match(e.mediaRange)
+		if level == matchNone {
+			continue
+		}
+		q := e.mediaRange.quality()
+		if q == 0 {
+			continue
+		}
+		if level > bestLevel ||
+			(level == bestLevel && params > bestParams) ||
+			(level == bestLevel && params == bestParams && q > bestQ) {
+			best, bestRange = e.value, e.mediaRange
+			bestLevel, bestParams, bestQ = level, params, q
+		}
+	}
+	return best, bestRange, bestLevel
+}
+
+// formatAccept メディアレンジの一覧をAcceptヘッダーの値として整形
+//
+// q値の降順に安定ソートし、同じ "type/subtype" とパラメータの組は最初のものだけを残します。
+func formatAccept(ranges []MediaType) string {
+	ranges = slices.Clone(ranges)
+	slices.SortStableFunc(ranges, func(a, b MediaType) int {
+		qa, qb := a.quality(), b.quality()
+		switch {
+		case qa > qb:
+			return -1
+		case qa < qb:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	values := make([]string, 0, len(ranges))
+	seen := map[string]bool{}
+	for _, r := range ranges {
+		key := r.withoutQuality().String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		v := key
+		if q := r.quality(); q < 1 {
+			v += ";q=" + strconv.FormatFloat(q, 'f', -1, 64)
+		}
+		values = append(values, v)
+	}
+	return strings.Join(values, ", ")
+}
+
+// withoutQuality qパラメータを除いたメディアタイプを返す
+func (m MediaType) withoutQuality() MediaType {
+	if _, ok := m.Params["q"]; !ok {
+		return m
+	}
+	params := make(map[string]string, len(m.Params))
+	for k, v := range m.Params {
+		if k != "q" {
+			params[k] = v
+		}
+	}
+	return MediaType{Type: m.Type, Subtype: m.Subtype, Params: params}
+}
@@ -0,0 +1,26 @@
+package httpc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+)
+
+func TestParseMediaType(t *testing.T) {
+	mt, err := httpc.ParseMediaType("Application/Problem+JSON; charset=UTF-8")
+	assert.NoError(t, err)
+	assert.Equal(t, "application", mt.Type)
+	assert.Equal(t, "problem+json", mt.Subtype)
+	assert.Equal(t, "json", mt.Suffix())
+	assert.Equal(t, "UTF-8", mt.Charset())
+	assert.Equal(t, "application/problem+json", mt.Essence())
+
+	mt, err = httpc.ParseMediaType("")
+	assert.NoError(t, err)
+	assert.True(t, mt.IsZero())
+
+	_, err = httpc.ParseMediaType("text/plain; =")
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package httpc
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Handler HTTPリクエストを送信し、レスポンスを返す関数
+//
+// 返すレスポンスのボディは呼び出し元が読み込み、閉じます。
+type Handler func(*http.Request) (*http.Response, error)
+
+// Middleware Handlerを包み、リクエストの送信前後に処理を加える関数
+//
+// nextを呼び出さずにレスポンスを返すことで、送信を省略することもできます(キャッシュ等)。
+// ミドルウェアはリクエストの試行ごとに呼び出されます。
+//
+// 例:
+//
+//	func logging(next httpc.Handler) httpc.Handler {
+//		return func(req *http.Request) (*http.Response, error) {
+//			res, err := next(req)
+//			log.Println(req.Method, req.URL, err)
+//			return res, err
+//		}
+//	}
+type Middleware func(next Handler) Handler
+
+// chain ミドルウェアを先頭が最も外側となるように適用したHandlerを返す
+func chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// releaseBody 閉じられた時点で1度だけreleaseを呼び出すレスポンスボディ
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,81 @@
+package httpc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+)
+
+func tracing(name string, trace *[]string) httpc.Middleware {
+	return func(next httpc.Handler) httpc.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			*trace = append(*trace, name+":before")
+			res, err := next(req)
+			*trace = append(*trace, name+":after")
+			return res, err
+		}
+	}
+}
+
+func TestRequest_Use(t *testing.T) {
+	s, _ := newFlakyServer(t, 0, http.StatusOK, nil)
+
+	var trace []string
+	c := httpc.NewClient().Use(tracing("client1", &trace), tracing("client2", &trace))
+	_, err := httpc.NewRequestFrom[[]byte](c).Use(tracing("request", &trace)).Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"client1:before", "client2:before", "request:before",
+		"request:after", "client2:after", "client1:after",
+	}, trace)
+}
+
+func TestRequest_Use_Header(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Trace-Id")))
+	}))
+	defer s.Close()
+
+	b, err := httpc.NewRequest[[]byte]().Header("Accept", "text/plain").Use(func(next httpc.Handler) httpc.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "text/plain", req.Header.Get("Accept"))
+			req.Header.Set("X-Trace-Id", "abc")
+			return next(req)
+		}
+	}).Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(b))
+}
+
+func TestRequest_Use_ShortCircuit(t *testing.T) {
+	v, err := httpc.NewRequest[string]().Decoder("text/plain", func(b []byte) (string, error) {
+		return string(b), nil
+	}).Use(func(next httpc.Handler) httpc.Handler {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"text/plain"}},
+				Body:       io.NopCloser(strings.NewReader("stub")),
+				Request:    req,
+			}, nil
+		}
+	}).Get(context.Background(), "http://example.invalid/")
+	assert.NoError(t, err)
+	assert.Equal(t, "stub", v)
+}
+
+func TestRequest_Use_Retry(t *testing.T) {
+	s, _ := newFlakyServer(t, 2, http.StatusServiceUnavailable, nil)
+
+	var trace []string
+	_, err := httpc.NewRequest[[]byte]().Retry(fastRetry()).Use(tracing("mw", &trace)).Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Len(t, trace, 6)
+}
@@ -0,0 +1,96 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// DeviceAuth デバイス認可レスポンス(RFC 8628 Section 3.2)
+type DeviceAuth struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int64  `json:"expires_in"`
+	// Interval ポーリングの間隔(秒)
+	Interval int64 `json:"interval,omitempty"`
+}
+
+// defaultDeviceInterval デバイス認可レスポンスに間隔が含まれない場合のポーリングの間隔(RFC 8628 Section 3.2)
+const defaultDeviceInterval = 5 * time.Second
+
+// deviceAuthParams デバイス認可エンドポイントへのリクエストパラメータ
+type deviceAuthParams struct {
+	ClientID     string `schema:"client_id"`
+	ClientSecret string `schema:"client_secret,omitempty"`
+	Scope        string `schema:"scope,omitempty"`
+}
+
+// DeviceAuth デバイス認可リクエスト(RFC 8628 Section 3.1)を行う
+//
+// シークレットが設定されている場合は、トークンエンドポイントと同様にクライアント認証を行います。
+// 返された DeviceAuth の UserCode と VerificationURI をユーザーに提示し、
+// DeviceAccessToken によりユーザーの認可を待機してトークンを取得します。
+func (c *Config) DeviceAuth(ctx context.Context) (*DeviceAuth, error) {
+	r := newRequest[*DeviceAuth](c)
+	_, secret := clientAuth(c, r)
+	return r.PostForm(ctx, c.deviceAuthURL, &deviceAuthParams{
+		ClientID:     c.clientID,
+		ClientSecret: secret,
+		Scope:        strings.Join(c.scopes, " "),
+	})
+}
+
+// DeviceAccessToken デバイス認可の完了を待機し、トークンを取得(RFC 8628 Section 3.4, 3.5)
+//
+// トークンエンドポイントが authorization_pending を返す間は DeviceAuth.Interval の間隔でポーリングを続け、
+// slow_down を返した場合は間隔を5秒延長します。ユーザーが拒否した場合(access_denied)や
+// デバイスコードが失効した場合(expired_token)は *Error を返します。
+// ctxが終了した場合はそのエラーを返します。
+func (c *Config) DeviceAccessToken(ctx context.Context, da *DeviceAuth) (*Token, error) {
+	interval := defaultDeviceInterval
+	if da.Interval > 0 {
+		interval = time.Duration(da.Interval) * time.Second
+	}
+	if da.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(da.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	for {
+		if err := wait(ctx, interval); err != nil {
+			return nil, err
+		}
+
+		t, err := c.token(ctx, &tokenParams{
+			GrantType:  "urn:ietf:params:oauth:grant-type:device_code",
+			DeviceCode: da.DeviceCode,
+		})
+		var e *Error
+		if errors.As(err, &e) {
+			switch e.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		return t, err
+	}
+}
+
+// wait コンテキストに従って待機
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,288 @@
+// Package oauth2 OAuth 2.0 (RFC 6749) クライアント
+//
+// クライアントクレデンシャル、リフレッシュトークン、PKCE(RFC 7636)による認可コード、
+// デバイス認可グラント(RFC 8628)の各フローをサポートします。
+// トークンエンドポイントへのリクエストは httpc.Request により行われます。
+//
+// 取得したトークンは TokenSource により有効期限の前に自動的に更新され、
+// httpc.TokenAuth と組み合わせてリクエストに付与できます。
+//
+//	cfg := oauth2.NewConfig("client-id", "https://auth.example.com/token").ClientSecret("secret")
+//	c := httpc.NewClient().Auth(httpc.TokenAuth(cfg.ClientCredentialsTokenSource()))
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/codec"
+)
+
+// AuthStyle トークンエンドポイントに対するクライアント認証の方式
+type AuthStyle int
+
+const (
+	// AuthStyleInHeader Basic認証によりクライアント認証を行う(client_secret_basic)
+	AuthStyleInHeader AuthStyle = iota
+	// AuthStyleInParams リクエストボディのパラメータによりクライアント認証を行う(client_secret_post)
+	AuthStyleInParams
+)
+
+// Config OAuth 2.0 クライアントの設定
+//
+// Config は設定後に複数のgoroutineから共有できます。
+type Config struct {
+	clientID      string
+	clientSecret  string
+	tokenURL      string
+	authURL       string
+	deviceAuthURL string
+	redirectURL   string
+	scopes        []string
+	authStyle     AuthStyle
+	expiryDelta   time.Duration
+	client        *httpc.Client
+}
+
+// NewConfig Configを生成する関数
+//
+// tokenURLにはトークンエンドポイントのURLを指定します。
+func NewConfig(clientID, tokenURL string) *Config {
+	return &Config{
+		clientID:    clientID,
+		tokenURL:    tokenURL,
+		expiryDelta: time.Minute,
+	}
+}
+
+// ClientSecret クライアントシークレットを設定
+//
+// 空文字列の場合(パブリッククライアント)は、client_id パラメータのみを送信します。
+func (c *Config) ClientSecret(secret string) *Config {
+	c.clientSecret = secret
+	return c
+}
+
+// AuthURL 認可エンドポイントのURLを設定
+func (c *Config) AuthURL(u string) *Config {
+	c.authURL = u
+	return c
+}
+
+// DeviceAuthURL デバイス認可エンドポイント(RFC 8628)のURLを設定
+func (c *Config) DeviceAuthURL(u string) *Config {
+	c.deviceAuthURL = u
+	return c
+}
+
+// RedirectURL リダイレクトURIを設定
+func (c *Config) RedirectURL(u string) *Config {
+	c.redirectURL = u
+	return c
+}
+
+// Scopes 要求するスコープを設定
+func (c *Config) Scopes(scopes ...string) *Config {
+	c.scopes = scopes
+	return c
+}
+
+// AuthStyle クライアント認証の方式を設定
+//
+// 既定では AuthStyleInHeader です。
+func (c *Config) AuthStyle(s AuthStyle) *Config {
+	c.authStyle = s
+	return c
+}
+
+// ExpiryDelta TokenSource がトークンを有効期限のどれだけ前に更新するかを設定
+//
+// 既定では1分です。
+func (c *Config) ExpiryDelta(d time.Duration) *Config {
+	c.expiryDelta = d
+	return c
+}
+
+// Client トークンエンドポイント等へのリクエストに使用する httpc.Client を設定
+func (c *Config) Client(client *httpc.Client) *Config {
+	c.client = client
+	return c
+}
+
+// Token OAuth 2.0 のトークンレスポンス(RFC 6749 Section 5.1)
+//
+// 埋め込まれた httpc.Token により、httpc.TokenSource の返値として使用できます。
+type Token struct {
+	httpc.Token
+	RefreshToken string
+	Scope        string
+}
+
+// Error OAuth 2.0 のエラーレスポンス(RFC 6749 Section 5.2)
+//
+// トークンエンドポイントがエラーを返した場合、errors.As により取り出すことができます。
+// 元となる *httpc.Error も同様に取り出すことができます。
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	URI         string `json:"error_uri,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return "oauth2: " + e.Code + ": " + e.Description
+	}
+	return "oauth2: " + e.Code
+}
+
+var ErrNoAccessToken = errors.New("oauth2: server response missing access_token")
+var ErrNoRefreshToken = errors.New("oauth2: token expired and refresh token is not set")
+
+// tokenResponse トークンエンドポイントのレスポンスボディ
+type tokenResponse struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    expiresIn `json:"expires_in"`
+	Scope        string    `json:"scope"`
+}
+
+// expiresIn 有効期間の秒数
+//
+// 数値として返すべきところを文字列として返すサーバーがあるため、いずれも受け付けます。
+type expiresIn int64
+
+func (e *expiresIn) UnmarshalJSON(b []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		n = json.Number(s)
+	}
+	if n == "" {
+		*e = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(n.String(), 10, 64)
+	if err != nil {
+		return err
+	}
+	*e = expiresIn(v)
+	return nil
+}
+
+// tokenParams トークンエンドポイントへのリクエストパラメータ
+type tokenParams struct {
+	GrantType    string `schema:"grant_type"`
+	Scope        string `schema:"scope,omitempty"`
+	RefreshToken string `schema:"refresh_token,omitempty"`
+	Code         string `schema:"code,omitempty"`
+	RedirectURI  string `schema:"redirect_uri,omitempty"`
+	CodeVerifier string `schema:"code_verifier,omitempty"`
+	DeviceCode   string `schema:"device_code,omitempty"`
+	ClientID     string `schema:"client_id,omitempty"`
+	ClientSecret string `schema:"client_secret,omitempty"`
+}
+
+// ClientCredentials クライアントクレデンシャルグラント(RFC 6749 Section 4.4)によりトークンを取得
+func (c *Config) ClientCredentials(ctx context.Context) (*Token, error) {
+	return c.token(ctx, &tokenParams{
+		GrantType: "client_credentials",
+		Scope:     strings.Join(c.scopes, " "),
+	})
+}
+
+// Refresh リフレッシュトークン(RFC 6749 Section 6)によりトークンを更新
+//
+// レスポンスにリフレッシュトークンが含まれない場合は、指定したリフレッシュトークンを引き継ぎます。
+func (c *Config) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	t, err := c.token(ctx, &tokenParams{
+		GrantType:    "refresh_token",
+		RefreshToken: refreshToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+	return t, nil
+}
+
+// Exchange 認可コードをトークンと交換(RFC 6749 Section 4.1.3)
+//
+// verifierには AuthCodeURL に渡したPKCEのコード検証子を指定します。PKCEを使用しない場合は空文字列とします。
+func (c *Config) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	return c.token(ctx, &tokenParams{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  c.redirectURL,
+		CodeVerifier: verifier,
+	})
+}
+
+// token トークンエンドポイントにリクエストし、トークンを返す
+func (c *Config) token(ctx context.Context, params *tokenParams) (*Token, error) {
+	r := newRequest[tokenResponse](c)
+	params.ClientID, params.ClientSecret = clientAuth(c, r)
+
+	result, err := r.TryPostForm(ctx, c.tokenURL, params)
+	if err != nil {
+		return nil, err
+	}
+	var res tokenResponse
+	if err := result.As(&res); err != nil {
+		return nil, err
+	}
+	if res.AccessToken == "" {
+		return nil, ErrNoAccessToken
+	}
+
+	t := &Token{
+		Token: httpc.Token{
+			AccessToken: res.AccessToken,
+			TokenType:   res.TokenType,
+		},
+		RefreshToken: res.RefreshToken,
+		Scope:        res.Scope,
+	}
+	if res.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// clientAuth リクエストにクライアント認証(RFC 6749 Section 2.3.1)を設定
+//
+// AuthStyleInHeader でシークレットが設定されている場合はBasic認証を設定して空文字列を返し、
+// それ以外の場合はリクエストパラメータとして送信するクライアント識別子とシークレットを返します。
+func clientAuth[T any](c *Config, r *httpc.Request[T]) (clientID, clientSecret string) {
+	if c.authStyle == AuthStyleInHeader && c.clientSecret != "" {
+		// クライアント識別子とシークレットはフォームエンコードした上でBasic認証に用いる
+		r.BasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+		return "", ""
+	}
+	return c.clientID, c.clientSecret
+}
+
+// newRequest 認可サーバーに対するリクエストを生成
+//
+// Config.Client で指定したクライアントのAuthは引き継ぎません。
+// APIのための認証情報(TokenSource によるトークン等)を認可サーバーに送信しないためです。
+func newRequest[T any](c *Config) *httpc.Request[T] {
+	var r *httpc.Request[T]
+	if c.client != nil {
+		r = httpc.NewRequestFrom[T](c.client)
+	} else {
+		r = httpc.NewRequest[T]()
+	}
+	return r.Auth(nil).Codec(codec.JSON()).ErrorBody(&Error{})
+}
@@ -0,0 +1,317 @@
+package oauth2_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/oauth2"
+)
+
+// tokenServer テスト用の認可サーバー
+type tokenServer struct {
+	*httptest.Server
+	issued   atomic.Int32
+	requests []url.Values
+	mu       sync.Mutex
+
+	expiresIn int
+	handle    func(w http.ResponseWriter, form url.Values) bool
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	t.Helper()
+	ts := &tokenServer{expiresIn: expiresIn}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		ts.record(r)
+		if ts.handle != nil && ts.handle(w, r.PostForm) {
+			return
+		}
+		if r.PostForm.Get("grant_type") == "refresh_token" && r.PostForm.Get("refresh_token") != "r1" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown refresh token"})
+			return
+		}
+		n := ts.issued.Add(1)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  "a" + strconv.Itoa(int(n)),
+			"token_type":    "bearer",
+			"expires_in":    ts.expiresIn,
+			"refresh_token": "r1",
+		})
+	})
+	mux.HandleFunc("POST /device", func(w http.ResponseWriter, r *http.Request) {
+		ts.record(r)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"device_code":      "dc",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://example.com/device",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("GET /resource", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	})
+	ts.Server = httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// record 受信したリクエストのパラメータを記録
+//
+// Basic認証は "basic"、それ以外のAuthorizationヘッダーは "authorization" として記録します。
+func (ts *tokenServer) record(r *http.Request) {
+	_ = r.ParseForm()
+	if id, secret, ok := r.BasicAuth(); ok {
+		r.PostForm.Set("basic", id+":"+secret)
+	} else if v := r.Header.Get("Authorization"); v != "" {
+		r.PostForm.Set("authorization", v)
+	}
+	ts.mu.Lock()
+	ts.requests = append(ts.requests, r.PostForm)
+	ts.mu.Unlock()
+}
+
+func (ts *tokenServer) last() url.Values {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.requests[len(ts.requests)-1]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestConfig_ClientCredentials(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	cfg := oauth2.NewConfig("client", ts.URL+"/token").ClientSecret("s&cret").Scopes("read", "write")
+
+	tok, err := cfg.ClientCredentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", tok.AccessToken)
+	assert.True(t, tok.Valid())
+	assert.Equal(t, "client_credentials", ts.last().Get("grant_type"))
+	assert.Equal(t, "read write", ts.last().Get("scope"))
+	assert.Equal(t, "client:s%26cret", ts.last().Get("basic"))
+
+	_, err = cfg.AuthStyle(oauth2.AuthStyleInParams).ClientCredentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "client", ts.last().Get("client_id"))
+	assert.Equal(t, "s&cret", ts.last().Get("client_secret"))
+}
+
+func TestConfig_Refresh_Error(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	cfg := oauth2.NewConfig("client", ts.URL+"/token")
+
+	_, err := cfg.Refresh(context.Background(), "unknown")
+	var e *oauth2.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, "invalid_grant", e.Code)
+		assert.Equal(t, "unknown refresh token", e.Description)
+	}
+	var he *httpc.Error
+	if assert.ErrorAs(t, err, &he) {
+		assert.Equal(t, http.StatusBadRequest, he.StatusCode())
+	}
+}
+
+func TestConfig_Exchange_PKCE(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	cfg := oauth2.NewConfig("client", ts.URL+"/token").
+		AuthURL("https://auth.example.com/authorize").
+		RedirectURL("https://app.example.com/callback").
+		Scopes("openid")
+
+	verifier := oauth2.NewVerifier()
+	assert.Len(t, verifier, 43)
+
+	u, err := url.Parse(cfg.AuthCodeURL("xyz", verifier))
+	assert.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "client", q.Get("client_id"))
+	assert.Equal(t, "xyz", q.Get("state"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, oauth2.S256Challenge(verifier), q.Get("code_challenge"))
+
+	tok, err := cfg.Exchange(context.Background(), "code1", verifier)
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", tok.RefreshToken)
+	assert.Equal(t, "authorization_code", ts.last().Get("grant_type"))
+	assert.Equal(t, verifier, ts.last().Get("code_verifier"))
+	assert.Equal(t, "https://app.example.com/callback", ts.last().Get("redirect_uri"))
+	assert.Equal(t, "client", ts.last().Get("client_id"))
+}
+
+func TestS256Challenge(t *testing.T) {
+	// RFC 7636 Appendix B
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		oauth2.S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestConfig_DeviceAccessToken(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	var polls atomic.Int32
+	ts.handle = func(w http.ResponseWriter, form url.Values) bool {
+		if form.Get("grant_type") == "urn:ietf:params:oauth:grant-type:device_code" && polls.Add(1) == 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+			return true
+		}
+		return false
+	}
+	cfg := oauth2.NewConfig("client", ts.URL+"/token").DeviceAuthURL(ts.URL + "/device")
+
+	da, err := cfg.DeviceAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCD-EFGH", da.UserCode)
+
+	tok, err := cfg.DeviceAccessToken(context.Background(), da)
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", tok.AccessToken)
+	assert.Equal(t, int32(2), polls.Load())
+	assert.Equal(t, "dc", ts.last().Get("device_code"))
+}
+
+func TestConfig_DeviceAuth_ClientSecret(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	cfg := oauth2.NewConfig("client", ts.URL+"/token").DeviceAuthURL(ts.URL + "/device").ClientSecret("s&cret")
+
+	_, err := cfg.DeviceAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "client", ts.last().Get("client_id"))
+	assert.Equal(t, "client:s%26cret", ts.last().Get("basic"))
+	assert.Empty(t, ts.last().Get("client_secret"))
+
+	_, err = cfg.AuthStyle(oauth2.AuthStyleInParams).DeviceAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "client", ts.last().Get("client_id"))
+	assert.Equal(t, "s&cret", ts.last().Get("client_secret"))
+	assert.Empty(t, ts.last().Get("basic"))
+}
+
+func TestTokenSource_SharedClient(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+
+	for _, style := range []oauth2.AuthStyle{oauth2.AuthStyleInHeader, oauth2.AuthStyleInParams} {
+		// トークンの取得とAPIの呼び出しで同じクライアントを使用する(シークレットのない公開クライアント)
+		cfg := oauth2.NewConfig("client", ts.URL+"/token").AuthStyle(style)
+		c := httpc.NewClient().BaseURL(ts.URL).Auth(httpc.TokenAuth(cfg.TokenSource(&oauth2.Token{RefreshToken: "r1"})))
+		cfg.Client(c)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			b, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), "/resource")
+			assert.NoError(t, err)
+			assert.Equal(t, "Bearer a"+strconv.Itoa(int(ts.issued.Load())), string(b))
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("token refresh did not complete")
+		}
+
+		// APIのための認証情報は認可サーバーに送信しない
+		assert.Equal(t, "refresh_token", ts.last().Get("grant_type"))
+		assert.Empty(t, ts.last().Get("authorization"))
+		assert.Equal(t, "client", ts.last().Get("client_id"))
+	}
+}
+
+func TestTokenSource_Concurrent(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	src := oauth2.NewConfig("client", ts.URL+"/token").ClientSecret("secret").ClientCredentialsTokenSource()
+	c := httpc.NewClient().BaseURL(ts.URL).Auth(httpc.TokenAuth(src))
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), "/resource")
+			assert.NoError(t, err)
+			assert.Equal(t, "Bearer a1", string(b))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), ts.issued.Load())
+}
+
+func TestTokenSource_RefreshAhead(t *testing.T) {
+	ts := newTokenServer(t, 30)
+	cfg := oauth2.NewConfig("client", ts.URL+"/token")
+
+	initial, err := cfg.Exchange(context.Background(), "code1", "")
+	assert.NoError(t, err)
+
+	// 有効期限(30秒)が ExpiryDelta (1分)より短いため、取得のたびに更新される
+	src := cfg.TokenSource(initial)
+	tok, err := src.OAuth2Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "a2", tok.AccessToken)
+	assert.Equal(t, "refresh_token", ts.last().Get("grant_type"))
+	assert.Equal(t, "r1", tok.RefreshToken)
+
+	// ExpiryDelta を短くすると、有効期限内のトークンを再利用する
+	src = cfg.ExpiryDelta(0).TokenSource(tok)
+	again, err := src.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "a2", again.AccessToken)
+	assert.Equal(t, int32(2), ts.issued.Load())
+}
+
+func TestTokenSource_Unauthorized(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	// 最初に発行したトークンを受け付けないリソースサーバー
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer a1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer rs.Close()
+
+	src := oauth2.NewConfig("client", ts.URL+"/token").ClientCredentialsTokenSource()
+	c := httpc.NewClient().BaseURL(rs.URL).Auth(httpc.TokenAuth(src))
+	for range 2 {
+		b, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), "/")
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer a2", string(b))
+	}
+	assert.Equal(t, int32(2), ts.issued.Load())
+}
+
+func TestTokenSource_ExpiryDelta(t *testing.T) {
+	ts := newTokenServer(t, 5)
+	c := httpc.NewClient().BaseURL(ts.URL)
+
+	// 有効期限(5秒)が ExpiryDelta より長ければ、TokenAuth は同じトークンを使用する
+	src := oauth2.NewConfig("client", ts.URL+"/token").ExpiryDelta(time.Second).ClientCredentialsTokenSource()
+	for range 2 {
+		b, err := httpc.NewRequestFrom[[]byte](c).Auth(httpc.TokenAuth(src)).Get(context.Background(), "/resource")
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer a1", string(b))
+	}
+	assert.Equal(t, int32(1), ts.issued.Load())
+}
+
+func TestTokenSource_NoRefreshToken(t *testing.T) {
+	src := oauth2.NewConfig("client", "http://example.invalid/token").TokenSource(nil)
+	_, err := src.Token(context.Background())
+	assert.ErrorIs(t, err, oauth2.ErrNoRefreshToken)
+}
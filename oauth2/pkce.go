@@ -0,0 +1,55 @@
+package oauth2
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+)
+
+// NewVerifier PKCE(RFC 7636)のコード検証子を生成する関数
+//
+// 32バイトの乱数をbase64url(パディングなし)でエンコードした43文字の文字列を返します。
+func NewVerifier() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// S256Challenge コード検証子から S256 方式のコードチャレンジを算出する関数
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 認可エンドポイント(RFC 6749 Section 4.1.1)へのURLを返す
+//
+// stateにはCSRF対策のための値を指定します。verifierに NewVerifier で生成したコード検証子を指定すると、
+// S256 方式のコードチャレンジを付与します。空文字列の場合はPKCEを使用しません。
+// 同じコード検証子を Exchange に指定してください。
+func (c *Config) AuthCodeURL(state, verifier string) string {
+	v := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.clientID},
+	}
+	if c.redirectURL != "" {
+		v.Set("redirect_uri", c.redirectURL)
+	}
+	if len(c.scopes) > 0 {
+		v.Set("scope", strings.Join(c.scopes, " "))
+	}
+	if state != "" {
+		v.Set("state", state)
+	}
+	if verifier != "" {
+		v.Set("code_challenge", S256Challenge(verifier))
+		v.Set("code_challenge_method", "S256")
+	}
+
+	sep := "?"
+	if strings.Contains(c.authURL, "?") {
+		sep = "&"
+	}
+	return c.authURL + sep + v.Encode()
+}
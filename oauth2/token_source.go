@@ -0,0 +1,100 @@
+package oauth2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unvurn/httpc"
+)
+
+// TokenSource 取得したトークンを保持し、有効期限の前に自動的に更新する httpc.TokenSource
+//
+// トークンは有効期限の ExpiryDelta (既定では1分)前に更新されます。
+// httpc.TokenInvalidator を実装しているため、httpc.TokenAuth で使用すると有効期限の判定は TokenSource が行い、
+// 401 Unauthorized を受け取った場合は保持しているトークンを破棄して再取得します。
+// 更新は同時にひとつだけ行われ、その間に要求した他のgoroutineは更新の完了を待機します。
+// TokenSource は複数のgoroutineから安全に共有できます。
+type TokenSource struct {
+	fetch       func(ctx context.Context, current *Token) (*Token, error)
+	expiryDelta time.Duration
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// ClientCredentialsTokenSource クライアントクレデンシャルグラントによりトークンを取得する TokenSource を返す
+func (c *Config) ClientCredentialsTokenSource() *TokenSource {
+	return &TokenSource{
+		fetch: func(ctx context.Context, _ *Token) (*Token, error) {
+			return c.ClientCredentials(ctx)
+		},
+		expiryDelta: c.expiryDelta,
+	}
+}
+
+// TokenSource 取得済みのトークンを起点に、リフレッシュトークンにより更新する TokenSource を返す
+//
+// Exchange や DeviceAccessToken で取得したトークンを指定します。
+// トークンが失効し、リフレッシュトークンが存在しない場合は ErrNoRefreshToken を返します。
+func (c *Config) TokenSource(t *Token) *TokenSource {
+	return &TokenSource{
+		fetch: func(ctx context.Context, current *Token) (*Token, error) {
+			if current == nil || current.RefreshToken == "" {
+				return nil, ErrNoRefreshToken
+			}
+			return c.Refresh(ctx, current.RefreshToken)
+		},
+		expiryDelta: c.expiryDelta,
+		token:       t,
+	}
+}
+
+// Token httpc.TokenSource の実装
+func (s *TokenSource) Token(ctx context.Context) (*httpc.Token, error) {
+	t, err := s.OAuth2Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &t.Token, nil
+}
+
+// OAuth2Token リフレッシュトークン等を含む有効なトークンを返す
+func (s *TokenSource) OAuth2Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.valid() {
+		return s.token, nil
+	}
+	t, err := s.fetch(ctx, s.token)
+	if err != nil {
+		return nil, err
+	}
+	s.token = t
+	return t, nil
+}
+
+// Invalidate httpc.TokenInvalidator の実装
+//
+// 保持しているアクセストークンがtと一致する場合に破棄し、次回の取得時に更新します。
+// リフレッシュトークンは更新のために保持し続けます。
+func (s *TokenSource) Invalidate(t *httpc.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil || t == nil || s.token.AccessToken != t.AccessToken {
+		return
+	}
+	invalidated := *s.token
+	invalidated.AccessToken = ""
+	s.token = &invalidated
+}
+
+// valid 保持しているトークンが更新の必要なく使用できるかを返す
+func (s *TokenSource) valid() bool {
+	if s.token == nil || s.token.AccessToken == "" {
+		return false
+	}
+	return s.token.Expiry.IsZero() || time.Now().Add(s.expiryDelta).Before(s.token.Expiry)
+}
@@ -0,0 +1,213 @@
+package httpc
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// ReplayableBody 送信ごとに内容を再生成できるリクエストボディ
+//
+// TryDoFunc のpayloadFuncがこれを実装する値を返した場合は、送信(再試行、リダイレクトを含む)ごとに
+// GetBody により取得したボディを送信します。
+type ReplayableBody interface {
+	io.Reader
+	GetBody() (io.ReadCloser, error)
+}
+
+// payload 再送できるリクエストボディ
+//
+// openは送信ごとに呼び出され、[http.Request.GetBody] としても使用します。
+type payload struct {
+	open   func() (io.ReadCloser, error)
+	length int64 // 不明な場合は-1
+	closer func()
+}
+
+// newPayload payloadFuncが最初に返したボディから payload を生成
+//
+// ボディが再送できる型であればそのまま使用し、それ以外の場合は streamPayload を参照してください。
+func newPayload(first io.Reader, payloadFunc func() (io.Reader, error)) (*payload, error) {
+	switch b := first.(type) {
+	case ReplayableBody:
+		return &payload{open: b.GetBody, length: -1, closer: func() { closeReader(b) }}, nil
+	case *bytes.Buffer:
+		return bytesPayload(b.Bytes()), nil
+	case io.ReadSeeker:
+		return seekPayload(b)
+	}
+
+	return streamPayload(first, payloadFunc), nil
+}
+
+// streamPayload 送信ごとにpayloadFuncが生成するボディを読み出す payload を生成
+//
+// 最初の送信には生成済みのボディを使用し、payloadFuncは2回目以降の送信で初めて呼び出します。
+// payloadFuncが最初と同じ(一度しか読み出せない)readerを返した場合は、まだ読み出していなければ
+// 読み込んで保持し、既に読み出していれば ErrBodyNotReplayable を返します。
+// payloadFuncがnilを返した場合は空のボディとします。
+func streamPayload(first io.Reader, payloadFunc func() (io.Reader, error)) *payload {
+	var mu sync.Mutex
+	head := &streamReader{r: first}
+	opened := false
+	var buffered []byte
+	return &payload{
+		length: -1,
+		open: func() (io.ReadCloser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if buffered != nil {
+				return io.NopCloser(bytes.NewReader(buffered)), nil
+			}
+			if !opened {
+				opened = true
+				return head, nil
+			}
+			r, err := payloadFunc()
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				return http.NoBody, nil
+			}
+			if !sameReader(first, r) {
+				return readCloser(r), nil
+			}
+			if buffered, err = head.buffer(); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(bytes.NewReader(buffered)), nil
+		},
+		closer: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !opened {
+				closeReader(first)
+			}
+		},
+	}
+}
+
+// streamReader 最初に生成したボディを読み出すreader
+//
+// 読み出す前であれば、内容を読み込んで保持したものに置き換えられます。
+type streamReader struct {
+	mu   sync.Mutex
+	r    io.Reader
+	read bool
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.read = true
+	return s.r.Read(p)
+}
+
+func (s *streamReader) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	closeReader(s.r)
+	return nil
+}
+
+// buffer 内容を読み込み、以降は読み込んだ内容を読み出すように置き換える
+//
+// 既に読み出している場合は ErrBodyNotReplayable を返します。
+func (s *streamReader) buffer() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.read {
+		return nil, ErrBodyNotReplayable
+	}
+	b, err := io.ReadAll(s.r)
+	closeReader(s.r)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		b = []byte{}
+	}
+	s.r = bytes.NewReader(b)
+	return b, nil
+}
+
+// bytesPayload バイト列を送信ごとに読み出す payload を生成
+func bytesPayload(b []byte) *payload {
+	return &payload{
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		},
+		length: int64(len(b)),
+	}
+}
+
+// seekPayload 最初の位置から読み出す payload を生成
+//
+// 同じreaderを複製せずに共有し、openが返すボディはそれぞれ独立した読み出し位置を持ちます。
+func seekPayload(s io.ReadSeeker) (*payload, error) {
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	return &payload{
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(&seekReader{mu: &mu, s: s, offset: start}), nil
+		},
+		length: end - start,
+		closer: func() { closeReader(s) },
+	}, nil
+}
+
+// seekReader 共有した io.ReadSeeker を独立した位置から読み出すreader
+//
+// 認証(Auth)によるボディの読み出しと送信が交互に行われても、互いの位置に影響しません。
+type seekReader struct {
+	mu     *sync.Mutex
+	s      io.ReadSeeker
+	offset int64
+}
+
+func (r *seekReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.s.Seek(r.offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := r.s.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// close 送信の完了後に、未使用のボディおよび共有したreaderを閉じる
+func (p *payload) close() {
+	if p.closer != nil {
+		p.closer()
+	}
+}
+
+// sameReader 2つのreaderが同一の値であるかを返す
+func sameReader(a, b io.Reader) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+func readCloser(r io.Reader) io.ReadCloser {
+	if rc, ok := r.(io.ReadCloser); ok {
+		return rc
+	}
+	return io.NopCloser(r)
+}
+
+func closeReader(r io.Reader) {
+	if c, ok := r.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
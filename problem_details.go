@@ -0,0 +1,179 @@
+package httpc
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ProblemDetails HTTP APIにおける問題の詳細(RFC 9457)
+//
+// Content-Typeが application/problem+json もしくは application/problem+xml のエラーレスポンスは、
+// 自動的に *ProblemDetails としてデコードされます。
+// 元となる *Error をラップしているため、errors.As により *ProblemDetails と *Error の双方を取り出すことができます。
+type ProblemDetails struct {
+	// Type 問題の種類を識別するURI参照(未指定の場合は "about:blank")
+	Type string
+	// Title 問題の種類の要約
+	Title string
+	// Status ステータスコード(未指定の場合は0)
+	Status int
+	// Detail 当該問題の発生に固有の説明
+	Detail string
+	// Instance 当該問題の発生を識別するURI参照
+	Instance string
+	// Extensions 上記以外の拡張メンバー
+	//
+	// JSONの場合はデコードされた値、XMLの場合は要素の文字列値が格納されます。
+	Extensions map[string]any
+
+	err *Error
+}
+
+// problemDetailsNamespace XML形式の問題の詳細の名前空間(RFC 9457 Appendix B)
+const problemDetailsNamespace = "urn:ietf:rfc:7807"
+
+// decodeProblemDetails Content-Typeが問題の詳細を表す場合にボディをデコード
+//
+// 問題の詳細でない、もしくはデコードに失敗した場合はnilを返します。
+func decodeProblemDetails(res *http.Response, b []byte, mt MediaType) error {
+	if mt.Type != "application" || len(b) == 0 {
+		return nil
+	}
+
+	p := &ProblemDetails{}
+	switch mt.Subtype {
+	case "problem+json":
+		if err := json.Unmarshal(b, p); err != nil {
+			return nil
+		}
+	case "problem+xml":
+		if err := xml.Unmarshal(b, p); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	p.err = &Error{response: res, body: b}
+	return p
+}
+
+func (p *ProblemDetails) Error() string {
+	var parts []string
+	if p.err != nil {
+		parts = append(parts, p.err.summary())
+	} else if p.Status != 0 {
+		parts = append(parts, http.StatusText(p.Status))
+	}
+	if p.Title != "" {
+		parts = append(parts, p.Title)
+	}
+	if p.Detail != "" {
+		parts = append(parts, p.Detail)
+	}
+	return strings.Join(parts, ": ")
+}
+
+func (p *ProblemDetails) Unwrap() error {
+	if p.err == nil {
+		return nil
+	}
+	return p.err
+}
+
+// UnmarshalJSON JSON形式(application/problem+json)の問題の詳細をデコード
+//
+// RFC 9457 Section 3.1 に従い、型の異なるメンバーは無視します。
+func (p *ProblemDetails) UnmarshalJSON(b []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+
+	*p = ProblemDetails{Type: "about:blank"}
+	for k, raw := range members {
+		switch k {
+		case "type":
+			_ = json.Unmarshal(raw, &p.Type)
+		case "title":
+			_ = json.Unmarshal(raw, &p.Title)
+		case "status":
+			_ = json.Unmarshal(raw, &p.Status)
+		case "detail":
+			_ = json.Unmarshal(raw, &p.Detail)
+		case "instance":
+			_ = json.Unmarshal(raw, &p.Instance)
+		default:
+			var v any
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return err
+			}
+			if p.Extensions == nil {
+				p.Extensions = map[string]any{}
+			}
+			p.Extensions[k] = v
+		}
+	}
+	return nil
+}
+
+// UnmarshalXML XML形式(application/problem+xml)の問題の詳細をデコード
+//
+// 子要素を持つ拡張メンバーは、その内容をXML文字列のまま格納します。
+func (p *ProblemDetails) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = ProblemDetails{Type: "about:blank"}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var member struct {
+				Text  string `xml:",chardata"`
+				Inner string `xml:",innerxml"`
+			}
+			if err := d.DecodeElement(&member, &t); err != nil {
+				return err
+			}
+			value := strings.TrimSpace(member.Text)
+
+			name := t.Name.Local
+			if t.Name.Space != "" && t.Name.Space != problemDetailsNamespace {
+				// 他の名前空間の要素は標準メンバーとみなさない
+				name = ""
+			}
+			switch name {
+			case "type":
+				p.Type = value
+			case "title":
+				p.Title = value
+			case "status":
+				if status, err := strconv.Atoi(value); err == nil {
+					p.Status = status
+				}
+			case "detail":
+				p.Detail = value
+			case "instance":
+				p.Instance = value
+			default:
+				if strings.Contains(member.Inner, "<") {
+					p.setExtension(t.Name.Local, member.Inner)
+				} else {
+					p.setExtension(t.Name.Local, value)
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func (p *ProblemDetails) setExtension(key string, value any) {
+	if p.Extensions == nil {
+		p.Extensions = map[string]any{}
+	}
+	p.Extensions[key] = value
+}
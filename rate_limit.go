@@ -0,0 +1,246 @@
+package httpc
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter トークンバケットによる送信レートの制限と、同時実行数の制限
+//
+// 既定ではすべてのリクエストでひとつの制限を共有します。PerHost もしくは KeyFunc を指定すると、
+// キー(ホスト等)ごとに独立した制限を適用します。
+// Client と個々のリクエストの双方に RateLimiter を設定した場合は、すべての制限を満たすまで待機します。
+// 待機はリクエストのコンテキストに従い、コンテキストが終了した場合はそのエラーを返します。
+//
+// Adaptive を有効にすると、レスポンスの以下のヘッダーに従って送信レートを一時的に引き下げます。
+//   - X-RateLimit-Remaining, X-RateLimit-Reset (秒数もしくはUNIX時刻)
+//   - RateLimit-Remaining, RateLimit-Reset、および RateLimit (r, t パラメータ) (IETF draft-ietf-httpapi-ratelimit-headers)
+//   - ステータスコード429のレスポンスの Retry-After
+//
+// RateLimiter は複数のリクエスト・goroutineから共有できます。
+type RateLimiter struct {
+	rate        float64
+	burst       int
+	maxInFlight int
+	keyFunc     func(*http.Request) string
+	adaptive    bool
+
+	mu       sync.Mutex
+	limiters map[string]*limiter
+}
+
+// limiter キーごとの制限の状態
+type limiter struct {
+	tokens float64
+	last   time.Time
+
+	// resetAt までの送信レートの上限(レスポンスヘッダーから算出)
+	adaptiveRate float64
+	resetAt      time.Time
+	// blockedUntil までは送信しない(残数0もしくはRetry-After)
+	blockedUntil time.Time
+
+	inFlight chan struct{}
+}
+
+// NewRateLimiter RateLimiterを生成する関数
+//
+// rateは1秒あたりのリクエスト数、burstは連続して送信できるリクエスト数です。
+// rateに0以下を指定した場合は送信レートを制限せず、同時実行数(MaxInFlight を参照)のみを制限します。
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:     rate,
+		burst:    max(burst, 1),
+		limiters: map[string]*limiter{},
+	}
+}
+
+// MaxInFlight 同時に送信中とするリクエストの最大数を設定
+//
+// 0の場合は同時実行数を制限しません。
+func (l *RateLimiter) MaxInFlight(n int) *RateLimiter {
+	l.maxInFlight = n
+	return l
+}
+
+// PerHost ホスト(ポートを含む)ごとに独立した制限を適用するかを設定
+func (l *RateLimiter) PerHost(perHost bool) *RateLimiter {
+	if perHost {
+		l.keyFunc = func(req *http.Request) string { return req.URL.Host }
+	} else {
+		l.keyFunc = nil
+	}
+	return l
+}
+
+// KeyFunc 制限を共有する単位を決定する関数を設定
+func (l *RateLimiter) KeyFunc(f func(*http.Request) string) *RateLimiter {
+	l.keyFunc = f
+	return l
+}
+
+// Adaptive レスポンスのレート制限ヘッダーに従って送信レートを調整するかを設定
+func (l *RateLimiter) Adaptive(adaptive bool) *RateLimiter {
+	l.adaptive = adaptive
+	return l
+}
+
+// limiter リクエストに対応する制限の状態を返す
+func (l *RateLimiter) limiter(req *http.Request) *limiter {
+	key := ""
+	if l.keyFunc != nil {
+		key = l.keyFunc(req)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lim, ok := l.limiters[key]
+	if !ok {
+		lim = &limiter{tokens: float64(l.burst), last: time.Now()}
+		if l.maxInFlight > 0 {
+			lim.inFlight = make(chan struct{}, l.maxInFlight)
+		}
+		l.limiters[key] = lim
+	}
+	return lim
+}
+
+// wait リクエストを送信できるまで待機
+//
+// 送信可能となった場合は、レスポンスの受信完了後に呼び出す関数を返します。
+func (l *RateLimiter) wait(ctx context.Context, req *http.Request) (func(*http.Response), error) {
+	lim := l.limiter(req)
+
+	if lim.inFlight != nil {
+		select {
+		case lim.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if lim.inFlight != nil {
+			<-lim.inFlight
+		}
+	}
+
+	for {
+		d := l.reserve(lim, time.Now())
+		if d <= 0 {
+			break
+		}
+		if err := sleep(ctx, d); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	return func(res *http.Response) {
+		if l.adaptive && res != nil {
+			l.observe(lim, res, time.Now())
+		}
+		release()
+	}, nil
+}
+
+// reserve トークンを1つ消費し、消費できない場合は次に消費可能となるまでの時間を返す
+func (l *RateLimiter) reserve(lim *limiter, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(lim.blockedUntil) {
+		return lim.blockedUntil.Sub(now)
+	}
+
+	rate := l.rate
+	if now.Before(lim.resetAt) && (rate <= 0 || lim.adaptiveRate < rate) {
+		rate = lim.adaptiveRate
+	}
+	if rate <= 0 {
+		return 0
+	}
+
+	lim.tokens = min(lim.tokens+now.Sub(lim.last).Seconds()*rate, float64(l.burst))
+	lim.last = now
+	if lim.tokens >= 1 {
+		lim.tokens--
+		return 0
+	}
+	return time.Duration((1 - lim.tokens) / rate * float64(time.Second))
+}
+
+// observe レスポンスのレート制限ヘッダーを制限の状態に反映
+func (l *RateLimiter) observe(lim *limiter, res *http.Response, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After"), now); ok {
+			lim.blockedUntil = now.Add(d)
+			return
+		}
+	}
+
+	remaining, reset, ok := parseRateLimit(res.Header, now)
+	if !ok {
+		return
+	}
+	if remaining <= 0 {
+		lim.blockedUntil = now.Add(reset)
+		return
+	}
+	if reset > 0 {
+		lim.adaptiveRate = float64(remaining) / reset.Seconds()
+		lim.resetAt = now.Add(reset)
+	}
+}
+
+// parseRateLimit レート制限ヘッダーから残りのリクエスト数とリセットまでの時間を返す
+func parseRateLimit(h http.Header, now time.Time) (int, time.Duration, bool) {
+	if v := h.Get("RateLimit"); v != "" {
+		// draft-ietf-httpapi-ratelimit-headers (version 7以降): RateLimit: "default";r=50;t=30
+		var remaining, reset string
+		item, _, _ := strings.Cut(v, ",")
+		for _, p := range strings.Split(item, ";")[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			switch k {
+			case "r":
+				remaining = v
+			case "t":
+				reset = v
+			}
+		}
+		if r, d, ok := parseRemainingReset(remaining, reset, now); ok {
+			return r, d, true
+		}
+	}
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+		if r, d, ok := parseRemainingReset(h.Get(prefix+"Remaining"), h.Get(prefix+"Reset"), now); ok {
+			return r, d, true
+		}
+	}
+	return 0, 0, false
+}
+
+// unixTimeThreshold リセット時刻をUNIX時刻とみなす閾値(これ未満は秒数とみなす)
+const unixTimeThreshold = 1_000_000_000
+
+// parseRemainingReset 残りのリクエスト数とリセットまでの時間(秒数もしくはUNIX時刻)を解釈
+func parseRemainingReset(remaining, reset string, now time.Time) (int, time.Duration, bool) {
+	r, err := strconv.Atoi(strings.TrimSpace(remaining))
+	if err != nil {
+		return 0, 0, false
+	}
+	s, err := strconv.ParseInt(strings.TrimSpace(reset), 10, 64)
+	if err != nil || s < 0 {
+		return 0, 0, false
+	}
+	if s >= unixTimeThreshold {
+		return r, max(time.Unix(s, 0).Sub(now), 0), true
+	}
+	return r, time.Duration(s) * time.Second, true
+}
@@ -0,0 +1,129 @@
+package httpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+)
+
+func TestRateLimiter(t *testing.T) {
+	s, count := newFlakyServer(t, 0, http.StatusOK, nil)
+
+	r := httpc.NewRequest[[]byte]().RateLimit(httpc.NewRateLimiter(20, 1))
+	start := time.Now()
+	for range 4 {
+		_, err := r.Get(context.Background(), s.URL)
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 140*time.Millisecond)
+	assert.Equal(t, int32(4), count.Load())
+}
+
+func TestRateLimiter_Context(t *testing.T) {
+	s, count := newFlakyServer(t, 0, http.StatusOK, nil)
+
+	r := httpc.NewRequest[[]byte]().RateLimit(httpc.NewRateLimiter(1, 1))
+	_, err := r.Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = r.Get(ctx, s.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestRateLimiter_MaxInFlight(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer s.Close()
+
+	c := httpc.NewClient().RateLimit(httpc.NewRateLimiter(0, 1).MaxInFlight(2))
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := httpc.NewRequestFrom[[]byte](c).Get(context.Background(), s.URL)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestRateLimiter_PerHost(t *testing.T) {
+	s1, _ := newFlakyServer(t, 0, http.StatusOK, nil)
+	s2, _ := newFlakyServer(t, 0, http.StatusOK, nil)
+
+	r := httpc.NewRequest[[]byte]().RateLimit(httpc.NewRateLimiter(1, 1).PerHost(true))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := r.Get(ctx, s1.URL)
+	assert.NoError(t, err)
+	_, err = r.Get(ctx, s2.URL)
+	assert.NoError(t, err)
+}
+
+func TestRateLimiter_Adaptive(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"x-ratelimit", http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"60"}}},
+		{"ratelimit-fields", http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"60"}}},
+		{"ratelimit", http.Header{"Ratelimit": {`"default";r=0;t=60`}}},
+		{"epoch", http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"4102444800"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, vv := range tt.header {
+					w.Header()[k] = vv
+				}
+			}))
+			defer s.Close()
+
+			r := httpc.NewRequest[[]byte]().RateLimit(httpc.NewRateLimiter(100, 10).Adaptive(true))
+			_, err := r.Get(context.Background(), s.URL)
+			assert.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err = r.Get(ctx, s.URL)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		})
+	}
+}
+
+func TestRateLimiter_AdaptiveRetryAfter(t *testing.T) {
+	s, count := newFlakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}})
+
+	r := httpc.NewRequest[[]byte]().RateLimit(httpc.NewRateLimiter(0, 1).Adaptive(true))
+	_, err := r.Get(context.Background(), s.URL)
+	assert.ErrorIs(t, err, httpc.ErrRateLimited)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = r.Get(ctx, s.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), count.Load())
+}
@@ -3,18 +3,26 @@ package httpc
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"maps"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gorilla/schema"
 	. "github.com/unvurn/core"
+
+	"github.com/unvurn/httpc/codec"
 )
 
 type EncoderFunc func(any) (io.Reader, error)
 type DecoderFunc[T any] func([]byte) (T, error)
+type MediaDecoderFunc[T any] func(MediaType, []byte) (T, error)
 type ErrorHandlerFunc func(*http.Response, []byte) error
 
 func NewRequest[T any]() *Request[T] {
@@ -27,8 +35,7 @@ func NewRequest[T any]() *Request[T] {
 func NewRequestFunc[T any]() *Request[T] {
 	return &Request[T]{
 		headers:             http.Header{},
-		decoders:            map[string]DecoderFunc[T]{},
-		errorHandlers:       map[string]ErrorHandlerFunc{},
+		autoAccept:          true,
 		defaultErrorHandler: newError,
 	}
 }
@@ -37,40 +44,287 @@ func NewRequestFunc[T any]() *Request[T] {
 //
 // Tはレスポンスの型を表します。
 type Request[T any] struct {
-	method string
-	url    *url.URL
-	values url.Values
+	method  string
+	baseURL string
+	url     *url.URL
+	values  url.Values
+
+	headers      http.Header
+	auth         Auth
+	keepAlive    bool
+	autoAccept   bool
+	strictAccept bool
+
+	payload *payload
 
-	headers           http.Header
-	basicAuthUsername string
-	basicAuthPassword string
-	keepAlive         bool
+	retryPolicy    *RetryPolicy
+	circuitBreaker *CircuitBreaker
+	rateLimiters   []*RateLimiter
+	middlewares    []Middleware
+	session        *Session
+	cache          *Cache
 
-	body io.Reader
+	idempotencyKeyHeader string
+	idempotencyKeyFunc   func() string
+	idempotencyKey       string
+
+	successWhen func(*http.Response) bool
 
 	encoderContentType  string
 	encoder             EncoderFunc
-	decoders            map[string]DecoderFunc[T]
-	errorHandlers       map[string]ErrorHandlerFunc
+	decoders            mediaEntries[MediaDecoderFunc[T]]
+	statusDecoders      map[string]mediaEntries[MediaDecoderFunc[T]]
+	codecs              []codec.Codec
+	errorHandlers       mediaEntries[ErrorHandlerFunc]
+	statusErrorHandlers map[string]mediaEntries[ErrorHandlerFunc]
 	defaultErrorHandler ErrorHandlerFunc
+	errorBodyType       reflect.Type
 
 	// HttpClient HTTPクライアントを返すメソッド
 	httpClient *http.Client
 }
 
+// Clone Request[T]の複製を返す
+//
+// ヘッダー、クエリパラメータ、デコーダー、エラーハンドラー、コーデックの一覧は複製され、
+// 複製に対する設定の変更は元の Request[T] に影響しません(逆も同様です)。
+// 共通の設定を持つテンプレートから個々のリクエストを派生させる用途に使用できます。
+func (r *Request[T]) Clone() *Request[T] {
+	c := *r
+	c.headers = r.headers.Clone()
+	if r.values != nil {
+		c.values = cloneValues(r.values)
+	}
+	if r.url != nil {
+		u := *r.url
+		c.url = &u
+	}
+	c.decoders = slices.Clone(r.decoders)
+	c.statusDecoders = cloneStatusEntries(r.statusDecoders)
+	c.codecs = slices.Clone(r.codecs)
+	c.errorHandlers = slices.Clone(r.errorHandlers)
+	c.statusErrorHandlers = cloneStatusEntries(r.statusErrorHandlers)
+	c.rateLimiters = slices.Clone(r.rateLimiters)
+	c.middlewares = slices.Clone(r.middlewares)
+	return &c
+}
+
 func (r *Request[T]) Encoder(contentType string, encoder EncoderFunc) *Request[T] {
 	r.encoderContentType = contentType
 	r.encoder = encoder
 	return r
 }
 
+// Decoder Content-Typeに対するデコーダーを設定
+//
+// contentTypeには "application/json" のようなメディアタイプの他に、
+// "*/*", "application/*", "application/*+json" のようなメディアレンジを指定できます。
+// 選択の規則は MediaDecoder を参照してください。
 func (r *Request[T]) Decoder(contentType string, decoder DecoderFunc[T]) *Request[T] {
-	r.decoders[contentType] = decoder
+	return r.MediaDecoder(contentType, func(_ MediaType, b []byte) (T, error) {
+		return decoder(b)
+	})
+}
+
+// MediaDecoder メディアレンジに対するデコーダーを設定
+//
+// デコーダーにはレスポンスのメディアタイプ(charset等のパラメータを含む)が渡されます。
+// レスポンスのContent-Typeに一致するメディアレンジが複数ある場合は、以下の順に優先されます。
+//   - "type/subtype" の完全一致
+//   - "application/*+json" のようなサフィックス指定、もしくは "application/json" による "application/problem+json" 等への一致
+//   - "application/*" のようなサブタイプのワイルドカード
+//   - "*/*"
+//
+// 同じ度合いで一致するものの間では、一致したパラメータ(charset等)が多いもの、qパラメータが大きいもの、先に登録されたものの順に優先されます。
+// q=0 が指定されたメディアレンジは選択されません。
+func (r *Request[T]) MediaDecoder(mediaRange string, decoder MediaDecoderFunc[T]) *Request[T] {
+	r.decoders = r.decoders.set(mediaRange, decoder)
+	return r
+}
+
+// StatusDecoder ステータスコードとContent-Typeに対するデコーダーを設定
+//
+// statusには "206" のような個別のステータスコード、もしくは "2xx" のようなステータスクラスを指定します。
+// contentTypeには Decoder と同様にメディアレンジを指定できます。
+//
+// デコーダーは以下の順に選択されます。
+//   - 個別のステータスコードに対して登録されたもの
+//   - ステータスクラスに対して登録されたもの
+//   - Decoder, MediaDecoder, Codec で登録されたもの
+//
+// 各々の中ではメディアレンジによる選択(MediaDecoder を参照)を行い、一致するものがなければ次の候補に進みます。
+func (r *Request[T]) StatusDecoder(status, contentType string, decoder DecoderFunc[T]) *Request[T] {
+	return r.StatusMediaDecoder(status, contentType, func(_ MediaType, b []byte) (T, error) {
+		return decoder(b)
+	})
+}
+
+// StatusMediaDecoder ステータスコードとメディアレンジに対するデコーダーを設定
+//
+// 選択の規則は StatusDecoder を参照してください。
+func (r *Request[T]) StatusMediaDecoder(status, mediaRange string, decoder MediaDecoderFunc[T]) *Request[T] {
+	key := statusKey(status)
+	if r.statusDecoders == nil {
+		r.statusDecoders = map[string]mediaEntries[MediaDecoderFunc[T]]{}
+	}
+	r.statusDecoders[key] = r.statusDecoders[key].set(mediaRange, decoder)
 	return r
 }
 
+// Codec コーデックによりエンコーダー・デコーダーをまとめて設定
+//
+// 複数回呼び出すことで複数のコーデックを登録できます。
+// 登録したコーデックのContent-Typeは AutoAccept によるAcceptヘッダーに含まれます。
+// エンコーダーは最後に指定されたコーデックのものが使用されます。
+// デコーダーは登録順に [codec.Codec.Match] で判定され、レスポンスのContent-Typeに最初に一致したものが使用されます。
+// ただし Decoder で同じContent-Typeに対するデコーダーが登録されている場合はそちらが優先されます。
+func (r *Request[T]) Codec(c codec.Codec) *Request[T] {
+	r.encoderContentType = c.ContentType()
+	r.encoder = func(v any) (io.Reader, error) {
+		b, err := c.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+	r.codecs = append(r.codecs, c)
+	return r
+}
+
+// Error Content-Typeに対するエラーハンドラーを設定
+//
+// contentTypeにはメディアレンジを指定でき、Decoder と同じ規則で選択されます。
 func (r *Request[T]) Error(contentType string, errorFunc func(*http.Response, []byte) error) *Request[T] {
-	r.errorHandlers[contentType] = errorFunc
+	r.errorHandlers = r.errorHandlers.set(contentType, errorFunc)
+	return r
+}
+
+// Retry 再試行方針を設定
+//
+// 詳細は RetryPolicy を参照してください。nilを指定すると再試行を行いません。
+func (r *Request[T]) Retry(p *RetryPolicy) *Request[T] {
+	r.retryPolicy = p
+	return r
+}
+
+// CircuitBreaker サーキットブレーカーを設定
+//
+// 詳細は CircuitBreaker を参照してください。サーキットが開いている間は接続を行わず、*CircuitOpenError を返します。
+// 再試行方針が設定されている場合、サーキットブレーカーは試行ごとに適用され、遮断された時点で再試行を終了します。
+// nilを指定するとサーキットブレーカーを使用しません。
+func (r *Request[T]) CircuitBreaker(cb *CircuitBreaker) *Request[T] {
+	r.circuitBreaker = cb
+	return r
+}
+
+// RateLimit 送信レートと同時実行数の制限を追加
+//
+// 詳細は RateLimiter を参照してください。複数の RateLimiter を追加した場合は、追加した順にすべての制限を満たすまで待機します。
+// 再試行方針が設定されている場合、制限は試行ごとに適用されます。
+func (r *Request[T]) RateLimit(l *RateLimiter) *Request[T] {
+	r.rateLimiters = append(r.rateLimiters, l)
+	return r
+}
+
+// Use ミドルウェアを追加
+//
+// ミドルウェアは追加した順に外側から適用され、最も内側で送信レートの制限、サーキットブレーカー、
+// [http.Client] によるリクエストの送信が行われます。Client で追加したミドルウェアは、
+// リクエストごとに追加したミドルウェアよりも外側に適用されます。
+// ミドルウェアには Accept、認証等のヘッダーを設定した後の [http.Request] が渡され、
+// 再試行方針が設定されている場合は試行ごとに呼び出されます。
+func (r *Request[T]) Use(middlewares ...Middleware) *Request[T] {
+	r.middlewares = append(r.middlewares, middlewares...)
+	return r
+}
+
+// IdempotencyKey べき等キーを付与するかを設定
+//
+// 有効な場合、POST および PATCH リクエストに対して、呼び出しごとに生成したべき等キーを
+// Idempotency-Key ヘッダーとして付与します。キーは同じ呼び出しの再試行の間で共通です。
+// ヘッダーが明示的に指定されている場合はその値をべき等キーとして扱います。
+//
+// べき等キーを付与したリクエストは、RetryPolicy.RetryNonIdempotent の指定によらず再試行の対象となります。
+// 付与したキーは HttpResult.IdempotencyKey および Error.IdempotencyKey で参照できます。
+func (r *Request[T]) IdempotencyKey(enabled bool) *Request[T] {
+	if !enabled {
+		r.idempotencyKeyHeader = ""
+	} else if r.idempotencyKeyHeader == "" {
+		r.idempotencyKeyHeader = DefaultIdempotencyKeyHeader
+	}
+	return r
+}
+
+// IdempotencyKeyHeader べき等キーを付与するヘッダー名を設定し、べき等キーの付与を有効にする
+func (r *Request[T]) IdempotencyKeyHeader(name string) *Request[T] {
+	r.idempotencyKeyHeader = http.CanonicalHeaderKey(name)
+	return r
+}
+
+// IdempotencyKeyFunc べき等キーを生成する関数を設定し、べき等キーの付与を有効にする
+//
+// 既定では NewIdempotencyKey が使用されます。
+func (r *Request[T]) IdempotencyKeyFunc(f func() string) *Request[T] {
+	r.idempotencyKeyFunc = f
+	return r.IdempotencyKey(true)
+}
+
+// SuccessWhen レスポンスを成功とみなす条件を設定
+//
+// 既定では2xxのステータスコードを成功とみなします。
+// 成功とみなされなかったレスポンスはエラーハンドラーにより処理されます。
+func (r *Request[T]) SuccessWhen(f func(*http.Response) bool) *Request[T] {
+	r.successWhen = f
+	return r
+}
+
+// StatusError ステータスコードとContent-Typeに対するエラーハンドラーを設定
+//
+// statusには "404" のような個別のステータスコード、もしくは "4xx" のようなステータスクラスを指定します。
+// エラーハンドラーは StatusDecoder と同じ順に選択され、いずれにも一致しない場合は既定のエラーハンドラーが使用されます。
+func (r *Request[T]) StatusError(status, contentType string, errorFunc func(*http.Response, []byte) error) *Request[T] {
+	key := statusKey(status)
+	if r.statusErrorHandlers == nil {
+		r.statusErrorHandlers = map[string]mediaEntries[ErrorHandlerFunc]{}
+	}
+	r.statusErrorHandlers[key] = r.statusErrorHandlers[key].set(contentType, errorFunc)
+	return r
+}
+
+// ErrorBody エラーレスポンスのボディをデコードする型を設定
+//
+// prototypeにはデコード先の型の値、もしくはそのポインタ(例: &MyAPIError{})を指定します。
+// Error, StatusError で登録したエラーハンドラーに一致しないエラーレスポンスは、
+// Content-Typeに一致するコーデック(Codec を参照)により当該型の新しい値へデコードされ、*DecodedError として返されます。
+// デコード先の型(のポインタ)が error を実装していれば、errors.As により直接取り出すことができます。
+// 一致するコーデックが存在しない、もしくはデコードに失敗した場合は *Error を返します。
+func (r *Request[T]) ErrorBody(prototype any) *Request[T] {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		panic("invalid error body type, expected non-nil value")
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	r.errorBodyType = t
+	return r
+}
+
+// Session Cookieを送受信するセッションを設定
+//
+// 設定したSessionは HTTPClient で指定した [http.Client] のJarに優先します。
+// 詳細は Session を参照してください。
+func (r *Request[T]) Session(s *Session) *Request[T] {
+	r.session = s
+	return r
+}
+
+// Cache レスポンスを保存・再利用するキャッシュを設定
+//
+// キャッシュはミドルウェア(Use を参照)の外側に位置し、キャッシュから返すレスポンスに対してはミドルウェアを実行しません。
+// 詳細は Cache を参照してください。
+func (r *Request[T]) Cache(c *Cache) *Request[T] {
+	r.cache = c
 	return r
 }
 
@@ -89,7 +343,7 @@ func (r *Request[T]) Method(m string) *Request[T] {
 func (r *Request[T]) Headers(headers any) *Request[T] {
 	if h, ok := headers.(http.Header); ok {
 		if r.headers == nil {
-			r.headers = h
+			r.headers = h.Clone()
 		} else {
 			for key, values := range h {
 				for _, value := range values {
@@ -113,9 +367,45 @@ func (r *Request[T]) Header(key, value string) *Request[T] {
 	return r
 }
 
+// Auth 認証方式を設定
+//
+// 詳細は Auth, Challenger を参照してください。nilを指定すると認証情報を付与しません。
+func (r *Request[T]) Auth(a Auth) *Request[T] {
+	r.auth = a
+	return r
+}
+
+// BasicAuth Basic認証を設定
+//
+// Auth(BasicAuth(username, password)) と同等です。
 func (r *Request[T]) BasicAuth(username, password string) *Request[T] {
-	r.basicAuthUsername = username
-	r.basicAuthPassword = password
+	return r.Auth(BasicAuth(username, password))
+}
+
+// DigestAuth Digest認証を設定
+//
+// Auth(DigestAuth(username, password)) と同等です。詳細は DigestAuth を参照してください。
+// nonceは当該リクエスト(および Clone による複製)の間で共有されます。
+func (r *Request[T]) DigestAuth(username, password string) *Request[T] {
+	return r.Auth(DigestAuth(username, password))
+}
+
+// AutoAccept 登録済みのデコーダーからAcceptヘッダーを自動的に生成するかを設定
+//
+// 既定では有効です。Decoder, MediaDecoder で登録したメディアレンジ(qパラメータを含む)と
+// Codec で登録したコーデックのContent-Typeを、q値の降順に並べてAcceptヘッダーとします。
+// Header 等でAcceptヘッダーが明示的に指定されている場合はそちらが優先されます。
+func (r *Request[T]) AutoAccept(autoAccept bool) *Request[T] {
+	r.autoAccept = autoAccept
+	return r
+}
+
+// StrictAccept デコード可能なメディアタイプ以外のレスポンスをエラーとするかを設定
+//
+// 有効な場合、成功レスポンスのContent-Typeに一致するデコーダー・コーデックが存在しなければ、
+// デコードを試みることなく *NotAcceptableError を返します。ボディが空のレスポンスは対象外です。
+func (r *Request[T]) StrictAccept(strict bool) *Request[T] {
+	r.strictAccept = strict
 	return r
 }
 
@@ -136,6 +426,9 @@ func (r *Request[T]) Query(params ...any) *Request[T] {
 		key := params[0].(string)
 		value := params[1].(string)
 
+		if r.values == nil {
+			r.values = url.Values{}
+		}
 		r.values.Set(key, value)
 	} else {
 		panic("invalid number of parameters for Query method, expected 1 or 2")
@@ -158,15 +451,12 @@ func (r *Request[T]) Get(ctx context.Context, u string, params ...any) (T, error
 
 // TryGet HTTP GETリクエストを実行
 func (r *Request[T]) TryGet(ctx context.Context, u string, params ...any) (Result, error) {
-	return r.TryDoFunc(ctx, http.MethodGet, u, "", func() (io.Reader, error) {
-		if len(params) > 0 {
-			r.Query(params...)
-		}
+	return r.withQuery(params...).TryDoFunc(ctx, http.MethodGet, u, "", func() (io.Reader, error) {
 		return nil, nil
 	})
 }
 
-// Post HTTP GETリクエストを実行
+// Post HTTP POSTリクエストを実行
 func (r *Request[T]) Post(ctx context.Context, u string, params any) (T, error) {
 	var v T
 
@@ -179,13 +469,9 @@ func (r *Request[T]) Post(ctx context.Context, u string, params any) (T, error)
 	return v, err
 }
 
+// TryPost HTTP POSTリクエストを実行
 func (r *Request[T]) TryPost(ctx context.Context, u string, params any) (Result, error) {
-	if r.encoder == nil {
-		return nil, ErrNoAvailableEncoder
-	}
-	return r.TryDoFunc(ctx, http.MethodPost, u, r.encoderContentType, func() (io.Reader, error) {
-		return r.encoder(params)
-	})
+	return r.tryEncoded(ctx, http.MethodPost, u, params)
 }
 
 // PostForm HTTP POSTリクエストを実行
@@ -241,56 +527,201 @@ func (r *Request[T]) TryPostForm(ctx context.Context, u string, params any, atta
 		}
 
 		return r.TryDoFunc(ctx, http.MethodPost, u, mw.FormDataContentType(), func() (io.Reader, error) {
-			return &buf, nil
+			return bytes.NewReader(buf.Bytes()), nil
 		})
 	}
 }
 
-// DoFunc JSONエンコードされたデータをリクエストボディに含むHTTP POSTリクエストを実行
+// TryDoFunc payloadFuncが返すデータをリクエストボディに含むHTTPリクエストを実行
+//
+// リクエストごとの状態(メソッド、URL、ボディ等)は複製に対して設定されるため、
+// 同じ Request[T] に対して繰り返し呼び出しても互いに影響しません。
+//
+// payloadFuncはボディを生成する関数で、再試行やリダイレクト(307, 308)の際には同じ内容を再送するために再度呼び出されます。
+// ただし、payloadFuncが返すボディが以下の場合は、payloadFuncを再度呼び出さずにそのボディを再送に使用します。
+//   - ReplayableBody を実装する場合は、送信ごとに GetBody により取得したボディを送信します。
+//   - [io.ReadSeeker] の場合は、送信ごとに最初の位置まで戻して読み出します(Content-Lengthは残りの長さとなります)。
+//   - [*bytes.Buffer] の場合は、その内容を送信ごとに読み出します。
+//
+// それ以外の場合は、payloadFuncは2回目以降の送信で初めて呼び出されます。payloadFuncが毎回同じ(一度しか読み出せない)readerを
+// 返すときは、まだ読み出していなければ読み込んで保持し、既に送信していれば ErrBodyNotReplayable となります。
+// contentTypeが空の場合はContent-Typeヘッダーを付与しません。
 func (r *Request[T]) TryDoFunc(ctx context.Context, method, u, contentType string, payloadFunc func() (io.Reader, error)) (Result, error) {
-	r.method = method
+	c := r.Clone()
+	c.method = method
 
 	body, err := payloadFunc()
 	if err != nil {
 		return nil, err
 	}
 
-	if method != http.MethodGet {
-		r.headers.Set("Cache-Control", "no-cache")
+	if method != http.MethodGet && method != http.MethodHead {
+		c.headers.Set("Cache-Control", "no-cache")
+	}
+	if c.idempotencyKeyHeader != "" && requiresIdempotencyKey(method) {
+		c.idempotencyKey = c.headers.Get(c.idempotencyKeyHeader)
+		if c.idempotencyKey == "" {
+			generate := c.idempotencyKeyFunc
+			if generate == nil {
+				generate = NewIdempotencyKey
+			}
+			c.idempotencyKey = generate()
+			c.headers.Set(c.idempotencyKeyHeader, c.idempotencyKey)
+		}
 	}
-	if contentType != "" && body != nil {
-		r.headers.Set("Content-Type", contentType)
-		r.body = body
+	if body != nil {
+		if contentType != "" {
+			c.headers.Set("Content-Type", contentType)
+		}
+		if c.payload, err = newPayload(body, payloadFunc); err != nil {
+			return nil, err
+		}
+		defer c.payload.close()
 	}
 
-	err = r.loadURL(u)
+	err = c.loadURL(u)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := r.build(ctx)
-	if err != nil {
-		return nil, err
+	return c.do(ctx)
+}
+
+// withQuery クエリパラメータを設定した複製を返す
+//
+// paramsが空の場合はレシーバーをそのまま返します。
+func (r *Request[T]) withQuery(params ...any) *Request[T] {
+	if len(params) == 0 {
+		return r
 	}
-	return r.do(req)
+	return r.Clone().Query(params...)
 }
 
 // Put HTTP PUTリクエストを実行
-//
-// note: このメソッドは未実装です。
-func (r *Request[T]) Put(ctx context.Context) (T, error) {
-	panic("implement me")
+func (r *Request[T]) Put(ctx context.Context, u string, params any) (T, error) {
+	var v T
+
+	result, err := r.TryPut(ctx, u, params)
+	if err != nil {
+		// as zero value
+		return v, err
+	}
+	err = result.As(&v)
+	return v, err
+}
+
+// TryPut HTTP PUTリクエストを実行
+func (r *Request[T]) TryPut(ctx context.Context, u string, params any) (Result, error) {
+	return r.tryEncoded(ctx, http.MethodPut, u, params)
+}
+
+// Patch HTTP PATCHリクエストを実行
+func (r *Request[T]) Patch(ctx context.Context, u string, params any) (T, error) {
+	var v T
+
+	result, err := r.TryPatch(ctx, u, params)
+	if err != nil {
+		// as zero value
+		return v, err
+	}
+	err = result.As(&v)
+	return v, err
+}
+
+// TryPatch HTTP PATCHリクエストを実行
+func (r *Request[T]) TryPatch(ctx context.Context, u string, params any) (Result, error) {
+	return r.tryEncoded(ctx, http.MethodPatch, u, params)
 }
 
 // Delete HTTP DELETEリクエストを実行
 //
-// note: このメソッドは未実装です。
-func (r *Request[T]) Delete(ctx context.Context) (T, error) {
-	panic("implement me")
+// paramsは省略可能です。指定された場合はエンコーダーによりリクエストボディとして送信します。
+func (r *Request[T]) Delete(ctx context.Context, u string, params ...any) (T, error) {
+	var v T
+
+	result, err := r.TryDelete(ctx, u, params...)
+	if err != nil {
+		// as zero value
+		return v, err
+	}
+	err = result.As(&v)
+	return v, err
+}
+
+// TryDelete HTTP DELETEリクエストを実行
+//
+// paramsは省略可能です。指定された場合はエンコーダーによりリクエストボディとして送信します。
+func (r *Request[T]) TryDelete(ctx context.Context, u string, params ...any) (Result, error) {
+	switch len(params) {
+	case 0:
+		return r.TryDoFunc(ctx, http.MethodDelete, u, "", func() (io.Reader, error) {
+			return nil, nil
+		})
+	case 1:
+		return r.tryEncoded(ctx, http.MethodDelete, u, params[0])
+	default:
+		panic("invalid number of parameters for Delete method, expected 0 or 1")
+	}
+}
+
+// Head HTTP HEADリクエストを実行
+//
+// レスポンスボディのデコードは行わず、レスポンスヘッダーのみを返します。
+// paramsは Get と同様にクエリパラメータとして扱われます。
+func (r *Request[T]) Head(ctx context.Context, u string, params ...any) (http.Header, error) {
+	result, err := r.TryHead(ctx, u, params...)
+	if err != nil {
+		return nil, err
+	}
+	var h http.Header
+	err = result.As(&h)
+	return h, err
+}
+
+// TryHead HTTP HEADリクエストを実行
+func (r *Request[T]) TryHead(ctx context.Context, u string, params ...any) (Result, error) {
+	return r.withQuery(params...).TryDoFunc(ctx, http.MethodHead, u, "", func() (io.Reader, error) {
+		return nil, nil
+	})
+}
+
+// Options HTTP OPTIONSリクエストを実行
+//
+// レスポンスボディのデコードは行わず、レスポンスヘッダー(Allow等)のみを返します。
+// レスポンスボディが必要な場合は TryOptions を使用してください。
+func (r *Request[T]) Options(ctx context.Context, u string) (http.Header, error) {
+	result, err := r.TryOptions(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	var h http.Header
+	err = result.As(&h)
+	return h, err
+}
+
+// TryOptions HTTP OPTIONSリクエストを実行
+func (r *Request[T]) TryOptions(ctx context.Context, u string) (Result, error) {
+	return r.TryDoFunc(ctx, http.MethodOptions, u, "", func() (io.Reader, error) {
+		return nil, nil
+	})
+}
+
+// tryEncoded エンコーダーによりparamsをリクエストボディとしたHTTPリクエストを実行
+func (r *Request[T]) tryEncoded(ctx context.Context, method, u string, params any) (Result, error) {
+	if r.encoder == nil {
+		return nil, ErrNoAvailableEncoder
+	}
+	return r.TryDoFunc(ctx, method, u, r.encoderContentType, func() (io.Reader, error) {
+		return r.encoder(params)
+	})
 }
 
 // loadURL URLを分解して保持
 func (r *Request[T]) loadURL(s string) error {
+	s, err := resolveURL(r.baseURL, s)
+	if err != nil {
+		return err
+	}
 	u, err := url.Parse(s)
 	if err != nil {
 		return err
@@ -308,6 +739,15 @@ func (r *Request[T]) loadURL(s string) error {
 	return nil
 }
 
+// cloneValues url.Valuesの複製を返す
+func cloneValues(v url.Values) url.Values {
+	c := make(url.Values, len(v))
+	for k, vv := range v {
+		c[k] = slices.Clone(vv)
+	}
+	return c
+}
+
 // build http.Requestインスタンスを構築
 //
 // コンテキストを付与してHTTPリクエスト [http.Request] を作成し、ヘッダーとボディを設定します。
@@ -317,16 +757,36 @@ func (r *Request[T]) loadURL(s string) error {
 // 当該依存関係が正当なものかの再検討により、今後この関数は再設計の対象となりえます。
 func (r *Request[T]) build(ctx context.Context) (*http.Request, error) {
 	r.url.RawQuery = r.values.Encode()
-	req, err := http.NewRequestWithContext(ctx, r.method, r.url.String(), r.body)
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url.String(), nil)
 	if err != nil {
 		return nil, err
 	}
+	if r.payload != nil {
+		// 再試行やリダイレクト(307, 308)の際にボディを再送できるよう、GetBodyを設定する
+		req.GetBody = r.payload.open
+		if req.Body, err = r.payload.open(); err != nil {
+			return nil, err
+		}
+		if r.payload.length == 0 {
+			_ = req.Body.Close()
+			req.Body = http.NoBody
+		} else if r.payload.length > 0 {
+			req.ContentLength = r.payload.length
+		}
+	}
 
 	if r.headers != nil {
-		req.Header = r.headers
+		req.Header = r.headers.Clone()
 	}
-	if r.basicAuthUsername != "" && r.basicAuthPassword != "" {
-		req.SetBasicAuth(r.basicAuthUsername, r.basicAuthPassword)
+	if r.autoAccept && req.Header.Get("Accept") == "" {
+		if accept := r.accept(); accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+	}
+	if r.auth != nil {
+		if err := r.auth.Apply(req); err != nil {
+			return nil, err
+		}
 	}
 	req.Close = !r.keepAlive
 	return req, nil
@@ -334,52 +794,309 @@ func (r *Request[T]) build(ctx context.Context) (*http.Request, error) {
 
 // do HTTPリクエストを実行する
 //
-// reqはhttp.Requestを表し、respondersはレスポンスを処理するための関数のスライスです。
+// 再試行方針(Retry を参照)が設定されている場合は、方針に従って試行を繰り返します。
 // レスポンスの型Tを返し、エラーが発生した場合はエラーを返します。
-func (r *Request[T]) do(req *http.Request) (Result, error) {
+// 返されたエラーが *Error を含む場合は、試行回数を Error.Attempts で参照できます。
+func (r *Request[T]) do(ctx context.Context) (Result, error) {
+	maxAttempts := r.retryPolicy.attempts(r.method, r.idempotencyKey != "")
+
+	var delay time.Duration
+	challenged := false
+	for attempt := 1; ; attempt++ {
+		res, b, err := r.send(ctx)
+		if err == nil && res.StatusCode == http.StatusUnauthorized && !challenged {
+			// 認証情報を更新できる場合は、1度だけ再送する
+			if ch, ok := r.auth.(Challenger); ok {
+				retry, cerr := ch.Challenge(res)
+				if cerr != nil {
+					return nil, cerr
+				}
+				if retry {
+					challenged = true
+					res, b, err = r.send(ctx)
+				}
+			}
+		}
+		if attempt < maxAttempts && r.retryPolicy.shouldRetry(ctx, res, err) {
+			if d, ok := r.retryPolicy.delay(attempt, delay, res); ok {
+				if err := sleep(ctx, d); err != nil {
+					return nil, err
+				}
+				delay = d
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := r.handle(res, b)
+		if hr, ok := result.(*HttpResult[T]); ok {
+			hr.idempotencyKey = r.idempotencyKey
+		}
+		var e *Error
+		if errors.As(err, &e) {
+			e.attempts = attempt
+			e.idempotencyKey = r.idempotencyKey
+		}
+		return result, err
+	}
+}
+
+// send HTTPリクエストを1回送信し、レスポンスとそのボディを返す
+//
+// リクエストはミドルウェア(Use を参照)を経て transport により送信されます。
+func (r *Request[T]) send(ctx context.Context) (*http.Response, []byte, error) {
+	if p := r.retryPolicy; p != nil && p.attemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.attemptTimeout)
+		defer cancel()
+	}
+
+	req, err := r.build(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handler := chain(r.transport, r.middlewares...)
+	if r.cache != nil {
+		handler = r.cache.handler(handler)
+	}
+	res, err := handler(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.Body == nil {
+		return res, nil, nil
+	}
+
+	defer func() { _ = res.Body.Close() }()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, b, nil
+}
+
+// transport ミドルウェアの最も内側でHTTPリクエストを送信するHandler
+//
+// 送信レートの制限(RateLimit を参照)を満たすまで待機し、サーキットブレーカー(CircuitBreaker を参照)が
+// 開いている場合は接続せずにエラーを返します。
+func (r *Request[T]) transport(req *http.Request) (*http.Response, error) {
+	var dones []func(*http.Response)
+	release := func(res *http.Response) {
+		for _, done := range dones {
+			done(res)
+		}
+	}
+
+	for _, l := range r.rateLimiters {
+		done, err := l.wait(req.Context(), req)
+		if err != nil {
+			release(nil)
+			return nil, err
+		}
+		dones = append(dones, done)
+	}
+
+	var record func(*http.Response, error)
+	if cb := r.circuitBreaker; cb != nil {
+		var err error
+		if record, err = cb.allow(req); err != nil {
+			release(nil)
+			return nil, err
+		}
+	}
+
 	client := r.httpClient
 	if client == nil {
 		client = http.DefaultClient
 	}
+	if r.session != nil {
+		// リダイレクト先でもCookieを送受信するため、Jarを差し替えたhttp.Clientを用いる
+		c := *client
+		c.Jar = r.session
+		client = &c
+	}
 
 	res, err := client.Do(req)
+	if record != nil {
+		record(res, err)
+	}
 	if err != nil {
+		release(nil)
 		return nil, err
 	}
 
-	defer func() { _ = res.Body.Close() }()
-	b, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+	// 同時実行数の枠はボディを閉じた時点で解放する
+	if len(dones) > 0 {
+		res.Body = &releaseBody{ReadCloser: res.Body, release: func() { release(res) }}
 	}
+	return res, nil
+}
 
-	if res.StatusCode != http.StatusOK {
+// handle レスポンスを成功・エラーに振り分けて処理
+func (r *Request[T]) handle(res *http.Response, b []byte) (Result, error) {
+	if !r.success(res) {
 		return nil, r.handleErrorResponse(res, b)
 	}
+	if r.strictAccept && len(b) > 0 && !r.acceptable(res) {
+		return nil, newNotAcceptableError(res, b, res.Request.Header.Get("Accept"))
+	}
 
 	return r.handleResponse(res, b)
 }
 
+// accept 登録済みのデコーダー・コーデックからAcceptヘッダーの値を生成
+func (r *Request[T]) accept() string {
+	ranges := make([]MediaType, 0, len(r.decoders)+len(r.codecs))
+	for _, e := range r.decoders {
+		if !e.mediaRange.IsZero() {
+			ranges = append(ranges, e.mediaRange)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(r.statusDecoders)) {
+		for _, e := range r.statusDecoders[key] {
+			if !e.mediaRange.IsZero() {
+				ranges = append(ranges, e.mediaRange)
+			}
+		}
+	}
+	for _, c := range r.codecs {
+		if mt, err := ParseMediaType(c.ContentType()); err == nil {
+			ranges = append(ranges, mt)
+		}
+	}
+	return formatAccept(ranges)
+}
+
+// acceptable レスポンスのContent-Typeに一致するデコーダー・コーデックが存在するかを返す
+func (r *Request[T]) acceptable(res *http.Response) bool {
+	header := res.Header.Get("Content-Type")
+	_, level := r.decoder(res.StatusCode, header, parseContentType(header))
+	return level != matchNone
+}
+
+// success レスポンスが成功であるかを判定
+func (r *Request[T]) success(res *http.Response) bool {
+	if r.successWhen != nil {
+		return r.successWhen(res)
+	}
+	return res.StatusCode >= 200 && res.StatusCode < 300
+}
+
 func (r *Request[T]) handleResponse(res *http.Response, b []byte) (Result, error) {
-	ct := contentType(res.Header.Get("Content-Type"))
-	decoder := r.decoders[ct]
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusResetContent {
+		// ボディを持たないレスポンスはデコーダーを呼び出さずゼロ値とする
+		noContent := func([]byte, any) error { return nil }
+		return newHttpResult[T](res, b, MediaType{}, func([]byte) (T, error) {
+			var zero T
+			return zero, nil
+		}, noContent), nil
+	}
+
+	header := res.Header.Get("Content-Type")
+	mt := parseContentType(header)
+
+	decode, _ := r.decoder(res.StatusCode, header, mt)
 
-	return newHttpResult[T](res, b, decoder), nil
+	var unmarshal func([]byte, any) error
+	if c, _ := r.codec(header, mt); c != nil {
+		unmarshal = c.Unmarshal
+	}
+
+	var decoder DecoderFunc[T]
+	if decode != nil {
+		decoder = func(b []byte) (T, error) {
+			return decode(mt, b)
+		}
+	}
+	return newHttpResult[T](res, b, mt, decoder, unmarshal), nil
 }
 
+// decoder ステータスコードとContent-Typeに最も適合するデコーダーを返す
+//
+// 選択の規則は StatusDecoder を参照してください。第2返値は一致の度合いで、一致するものがない場合は matchNone となります。
+func (r *Request[T]) decoder(code int, header string, mt MediaType) (MediaDecoderFunc[T], int) {
+	if decode, level := negotiateStatus(r.statusDecoders, code, mt); level != matchNone {
+		return decode, level
+	}
+
+	decode, _, level := r.decoders.negotiate(mt)
+	if c, l := r.codec(header, mt); c != nil && l > level {
+		return func(_ MediaType, b []byte) (T, error) {
+			var v T
+			err := c.Unmarshal(b, &v)
+			return v, err
+		}, l
+	}
+	return decode, level
+}
+
+// codec Content-Typeに一致するコーデックとその一致の度合いを返す
+//
+// コーデックの ContentType と完全に一致するものを優先し、それ以外は登録順に [codec.Codec.Match] で判定します。
+// 一致するコーデックが存在しない場合はnilを返します。
+func (r *Request[T]) codec(header string, mt MediaType) (codec.Codec, int) {
+	var matched codec.Codec
+	for _, c := range r.codecs {
+		if !c.Match(header) {
+			continue
+		}
+		if c.ContentType() == mt.Essence() {
+			return c, matchExact
+		}
+		if matched == nil {
+			matched = c
+		}
+	}
+	if matched == nil {
+		return nil, matchNone
+	}
+	return matched, matchSuffix
+}
+
+// handleErrorResponse エラーレスポンスを処理
+//
+// エラーは以下の順に決定されます。
+//   - Error, StatusError で登録したエラーハンドラー
+//   - ErrorBody で指定した型へのデコード
+//   - Content-Typeが application/problem+json, application/problem+xml の場合は *ProblemDetails
+//   - 既定のエラーハンドラー(*Error)
 func (r *Request[T]) handleErrorResponse(res *http.Response, b []byte) error {
-	ct := contentType(res.Header.Get("Content-Type"))
-	handler := r.errorHandlers[ct]
-	if handler == nil {
-		handler = r.defaultErrorHandler
+	mt := parseContentType(res.Header.Get("Content-Type"))
+	handler, level := negotiateStatus(r.statusErrorHandlers, res.StatusCode, mt)
+	if level == matchNone {
+		handler, _, _ = r.errorHandlers.negotiate(mt)
+	}
+	if handler != nil {
+		return handler(res, b)
 	}
 
-	return handler(res, b)
+	if r.errorBodyType != nil {
+		if err := r.decodeErrorBody(res, b); err != nil {
+			return err
+		}
+	}
+	if err := decodeProblemDetails(res, b, mt); err != nil {
+		return err
+	}
+	return r.defaultErrorHandler(res, b)
 }
 
-func contentType(value string) string {
-	if value == "" {
-		return ""
+// decodeErrorBody エラーレスポンスのボディを ErrorBody で指定された型にデコード
+//
+// 一致するコーデックが存在しない、もしくはデコードに失敗した場合はnilを返します。
+func (r *Request[T]) decodeErrorBody(res *http.Response, b []byte) error {
+	header := res.Header.Get("Content-Type")
+	c, _ := r.codec(header, parseContentType(header))
+	if c == nil || len(b) == 0 {
+		return nil
+	}
+
+	v := reflect.New(r.errorBodyType).Interface()
+	if err := c.Unmarshal(b, v); err != nil {
+		return nil
 	}
-	return strings.Split(strings.TrimSpace(value), ";")[0]
+	return newDecodedError(res, b, v)
 }
@@ -1,10 +1,13 @@
 package httpc_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"testing"
@@ -12,6 +15,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/codec"
 	"github.com/unvurn/httpc/form"
 )
 
@@ -259,3 +263,382 @@ func TestHttpbin_BasicAuth_Unauthorized(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, e.StatusCode())
 	assert.Nil(t, resp)
 }
+
+/////
+
+func newEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Allow", "GET, HEAD, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"body":   string(b),
+		})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func jsonRequest() *httpc.Request[map[string]string] {
+	return httpc.NewRequest[map[string]string]().
+		Encoder("application/json", func(v any) (io.Reader, error) {
+			b, err := json.Marshal(v)
+			return bytes.NewReader(b), err
+		}).
+		Decoder("application/json", func(b []byte) (map[string]string, error) {
+			var v map[string]string
+			err := json.Unmarshal(b, &v)
+			return v, err
+		})
+}
+
+func TestRequest_PutPatch(t *testing.T) {
+	s := newEchoServer(t)
+
+	resp, err := jsonRequest().Put(context.Background(), s.URL, map[string]int{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPut, resp["method"])
+	assert.JSONEq(t, `{"a":1}`, resp["body"])
+
+	resp, err = jsonRequest().Patch(context.Background(), s.URL, map[string]int{"b": 2})
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPatch, resp["method"])
+	assert.JSONEq(t, `{"b":2}`, resp["body"])
+
+	_, err = httpc.NewRequest[[]byte]().Put(context.Background(), s.URL, nil)
+	assert.ErrorIs(t, err, httpc.ErrNoAvailableEncoder)
+}
+
+func TestRequest_Delete(t *testing.T) {
+	s := newEchoServer(t)
+
+	resp, err := jsonRequest().Delete(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodDelete, resp["method"])
+	assert.Empty(t, resp["body"])
+
+	resp, err = jsonRequest().Delete(context.Background(), s.URL, map[string]int{"c": 3})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"c":3}`, resp["body"])
+}
+
+func TestRequest_HeadOptions(t *testing.T) {
+	s := newEchoServer(t)
+
+	h, err := jsonRequest().Head(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodHead, h.Get("X-Method"))
+
+	h, err = jsonRequest().Options(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodOptions, h.Get("X-Method"))
+	assert.Contains(t, h.Get("Allow"), "OPTIONS")
+}
+
+func TestRequest_Codec(t *testing.T) {
+	type value struct {
+		Method string `json:"method"`
+		Body   string `json:"body"`
+	}
+
+	var accept string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/vnd.example+json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(value{Method: r.Method, Body: string(b)})
+	}))
+	defer s.Close()
+
+	v, err := httpc.NewRequest[value]().Codec(codec.JSON()).Post(context.Background(), s.URL, map[string]int{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, v.Method)
+	assert.JSONEq(t, `{"a":1}`, v.Body)
+	assert.Equal(t, "application/json", accept)
+}
+
+func TestRequest_Codec_ContentTypeDispatch(t *testing.T) {
+	type value struct {
+		Name string `json:"name" xml:"name" msgpack:"name" cbor:"name"`
+	}
+
+	codecs := []codec.Codec{codec.JSON(), codec.XML(), codec.MsgPack(), codec.CBOR()}
+	for _, c := range codecs {
+		t.Run(c.ContentType(), func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := c.Marshal(value{Name: c.ContentType()})
+				w.Header().Set("Content-Type", c.ContentType())
+				_, _ = w.Write(b)
+			}))
+			defer s.Close()
+
+			req := httpc.NewRequest[value]()
+			for _, c := range codecs {
+				req.Codec(c)
+			}
+			result, err := req.TryGet(context.Background(), s.URL)
+			assert.NoError(t, err)
+
+			var v value
+			assert.NoError(t, result.As(&v))
+			assert.Equal(t, c.ContentType(), v.Name)
+
+			var other struct {
+				Name string `json:"name" xml:"name" msgpack:"name" cbor:"name"`
+			}
+			assert.NoError(t, result.As(&other))
+			assert.Equal(t, c.ContentType(), other.Name)
+		})
+	}
+}
+
+func TestRequest_Decoder_Negotiation(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    string
+	}{
+		{"application/json", "json"},
+		{"application/problem+json", "json"},
+		{"application/vnd.github+json; charset=utf-8", "json"},
+		{"application/hal+xml", "+xml"},
+		{"application/octet-stream", "application/*"},
+		{"text/plain; charset=utf-8", "text/plain;charset=utf-8"},
+		{"text/plain; charset=iso-8859-1", "text/*"},
+		{"image/png", "*/*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+			}))
+			defer s.Close()
+
+			decoder := func(name string) httpc.MediaDecoderFunc[string] {
+				return func(mt httpc.MediaType, _ []byte) (string, error) {
+					return name, nil
+				}
+			}
+			v, err := httpc.NewRequest[string]().
+				MediaDecoder("*/*", decoder("*/*")).
+				MediaDecoder("application/*", decoder("application/*")).
+				MediaDecoder("text/*;q=0.5", decoder("text/*")).
+				MediaDecoder("text/plain;charset=utf-8", decoder("text/plain;charset=utf-8")).
+				MediaDecoder("application/*+xml", decoder("+xml")).
+				MediaDecoder("application/json", decoder("json")).
+				Get(context.Background(), s.URL)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
+
+func TestRequest_MediaDecoder_Charset(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=Shift_JIS")
+	}))
+	defer s.Close()
+
+	result, err := httpc.NewRequest[string]().
+		MediaDecoder("text/plain", func(mt httpc.MediaType, _ []byte) (string, error) {
+			return mt.Charset(), nil
+		}).
+		TryGet(context.Background(), s.URL)
+	assert.NoError(t, err)
+
+	var v string
+	assert.NoError(t, result.As(&v))
+	assert.Equal(t, "Shift_JIS", v)
+	assert.Equal(t, "text/plain", result.(*httpc.HttpResult[string]).MediaType().Essence())
+}
+
+func TestRequest_AutoAccept(t *testing.T) {
+	var accept string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer s.Close()
+
+	decode := func(b []byte) (string, error) { return string(b), nil }
+	req := httpc.NewRequest[string]().
+		Decoder("text/*;q=0.5", decode).
+		Decoder("application/json", decode).
+		Codec(codec.XML()).
+		Codec(codec.JSON())
+
+	_, err := req.Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json, application/xml, text/*;q=0.5", accept)
+
+	_, err = httpc.NewRequest[string]().Decoder("application/json", decode).Header("Accept", "*/*").TryGet(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "*/*", accept)
+
+	_, err = httpc.NewRequest[string]().Decoder("application/json", decode).AutoAccept(false).TryGet(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, accept)
+}
+
+func TestRequest_StrictAccept(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	}))
+	defer s.Close()
+
+	_, err := httpc.NewRequest[map[string]any]().Codec(codec.JSON()).StrictAccept(true).Get(context.Background(), s.URL)
+	assert.ErrorIs(t, err, httpc.ErrNotAcceptable)
+	var e *httpc.NotAcceptableError
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, "text/html", e.ContentType())
+		assert.Equal(t, "application/json", e.Accept())
+		assert.Equal(t, "<html></html>", string(e.Body()))
+	}
+
+	_, err = httpc.NewRequest[map[string]any]().Codec(codec.JSON()).Get(context.Background(), s.URL)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, httpc.ErrNotAcceptable)
+}
+
+func TestRequest_Success(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status != http.StatusNoContent && status != http.StatusResetContent && status != http.StatusNotModified {
+			_, _ = w.Write([]byte(`{"status":"` + http.StatusText(status) + `"}`))
+		}
+	}))
+	defer s.Close()
+
+	for _, status := range []int{http.StatusOK, http.StatusCreated, http.StatusAccepted} {
+		v, err := jsonRequest().Post(context.Background(), s.URL+"?status="+strconv.Itoa(status), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusText(status), v["status"])
+	}
+
+	for _, status := range []int{http.StatusNoContent, http.StatusResetContent} {
+		v, err := httpc.NewRequest[map[string]string]().Delete(context.Background(), s.URL+"?status="+strconv.Itoa(status))
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+	}
+
+	_, err := jsonRequest().Get(context.Background(), s.URL+"?status=304")
+	var e *httpc.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, http.StatusNotModified, e.StatusCode())
+	}
+
+	_, err = jsonRequest().
+		SuccessWhen(func(res *http.Response) bool { return res.StatusCode == http.StatusOK }).
+		Get(context.Background(), s.URL+"?status=202")
+	assert.ErrorAs(t, err, &e)
+
+	v, err := jsonRequest().
+		SuccessWhen(func(res *http.Response) bool { return res.StatusCode < 500 }).
+		Get(context.Background(), s.URL+"?status=409")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusText(http.StatusConflict), v["status"])
+}
+
+func TestRequest_StatusDecoder(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+
+	decoder := func(name string) httpc.DecoderFunc[string] {
+		return func([]byte) (string, error) { return name, nil }
+	}
+	handler := func(name string) httpc.ErrorHandlerFunc {
+		return func(*http.Response, []byte) error { return errors.New(name) }
+	}
+	req := func() *httpc.Request[string] {
+		return httpc.NewRequest[string]().
+			Decoder("application/json", decoder("json")).
+			StatusDecoder("202", "*/*", decoder("202")).
+			StatusDecoder("2xx", "application/json", decoder("2xx")).
+			StatusDecoder("206", "text/plain", decoder("206")).
+			Error("application/json", handler("json")).
+			StatusError("4XX", "*/*", handler("4xx")).
+			StatusError("404", "application/json", handler("404"))
+	}
+
+	tests := []struct {
+		status   int
+		expected string
+	}{
+		{http.StatusOK, "2xx"},
+		{http.StatusAccepted, "202"},
+		{http.StatusPartialContent, "2xx"},
+		{http.StatusNotFound, "404"},
+		{http.StatusConflict, "4xx"},
+		{http.StatusInternalServerError, "json"},
+	}
+	for _, tt := range tests {
+		v, err := req().Get(context.Background(), s.URL+"?status="+strconv.Itoa(tt.status))
+		if tt.status < 300 {
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		} else {
+			assert.EqualError(t, err, tt.expected)
+		}
+	}
+
+	assert.Panics(t, func() { httpc.NewRequest[string]().StatusDecoder("2x", "*/*", decoder("")) })
+	assert.Panics(t, func() { httpc.NewRequest[string]().StatusError("600", "*/*", handler("")) })
+}
+
+func TestRequest_Clone(t *testing.T) {
+	var query url.Values
+	var header http.Header
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		header = r.Header.Clone()
+	}))
+	defer s.Close()
+
+	h := http.Header{"X-Template": {"1"}}
+	template := httpc.NewRequest[[]byte]().Headers(h).Query("fixed", "1")
+	h.Set("X-Template", "changed")
+
+	derived := template.Clone().Header("X-Derived", "1").Query("derived", "1")
+
+	_, err := template.Get(context.Background(), s.URL+"?a=1")
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"fixed": {"1"}, "a": {"1"}}, query)
+	assert.Equal(t, "1", header.Get("X-Template"))
+	assert.Empty(t, header.Get("X-Derived"))
+
+	_, err = template.Get(context.Background(), s.URL+"?a=1")
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"fixed": {"1"}, "a": {"1"}}, query)
+
+	_, err = template.Get(context.Background(), s.URL, "b", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"fixed": {"1"}, "b": {"2"}}, query)
+
+	_, err = template.Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"fixed": {"1"}}, query)
+
+	_, err = derived.Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"fixed": {"1"}, "derived": {"1"}}, query)
+	assert.Equal(t, "1", header.Get("X-Derived"))
+
+	_, err = template.PostForm(context.Background(), s.URL, params{Name: "a"})
+	assert.NoError(t, err)
+	_, err = template.Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, header.Get("Content-Type"))
+	assert.Empty(t, header.Get("Cache-Control"))
+}
@@ -7,23 +7,56 @@ import (
 type HttpResult[T any] struct {
 	Response *http.Response
 
-	bytes   []byte
-	decoder DecoderFunc[T]
+	bytes     []byte
+	mediaType MediaType
+	decoder   DecoderFunc[T]
+	unmarshal func([]byte, any) error
+
+	idempotencyKey string
 }
 
-func newHttpResult[T any](response *http.Response, bytes []byte, decoder DecoderFunc[T]) *HttpResult[T] {
+func newHttpResult[T any](response *http.Response, bytes []byte, mediaType MediaType, decoder DecoderFunc[T], unmarshal func([]byte, any) error) *HttpResult[T] {
 	return &HttpResult[T]{
-		Response: response,
-		bytes:    bytes,
-		decoder:  decoder,
+		Response:  response,
+		bytes:     bytes,
+		mediaType: mediaType,
+		decoder:   decoder,
+		unmarshal: unmarshal,
 	}
 }
 
+// MediaType レスポンスのメディアタイプ(charset等のパラメータを含む)を返す
+func (r *HttpResult[T]) MediaType() MediaType {
+	return r.mediaType
+}
+
+// IdempotencyKey リクエストに付与したべき等キーを返す
+//
+// べき等キーを付与しなかった場合は空文字列を返します。
+func (r *HttpResult[T]) IdempotencyKey() string {
+	return r.idempotencyKey
+}
+
+// FromCache レスポンスがキャッシュ(Request.Cache を参照)から返されたかを返す
+//
+// 保存したレスポンスを再検証せずに返した場合、および再検証の結果(304 Not Modified)により
+// 保存したレスポンスを返した場合にtrueを返します。
+func (r *HttpResult[T]) FromCache() bool {
+	return r.Response != nil && fromCache(r.Response.Header)
+}
+
+// As レスポンスボディを value に格納
+//
+// value には *[]byte(ボディそのもの)、*http.Header(レスポンスヘッダー)、*T(デコーダーによるデコード結果)を指定できます。
+// レスポンスのContent-Typeに一致するコーデックが登録されている場合は、それ以外の型へのポインタもデコード先として指定できます。
 func (r *HttpResult[T]) As(value any) error {
 	switch v := value.(type) {
 	case *[]byte:
 		*v = r.bytes
 		return nil
+	case *http.Header:
+		*v = r.Response.Header
+		return nil
 	case *T:
 		if r.decoder == nil {
 			return ErrNoAvailableDecoder
@@ -35,6 +68,9 @@ func (r *HttpResult[T]) As(value any) error {
 		*v = d
 		return nil
 	default:
+		if r.unmarshal != nil {
+			return r.unmarshal(r.bytes, value)
+		}
 		return ErrUnexpectedType
 	}
 }
@@ -0,0 +1,189 @@
+package httpc
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Jitter 再試行の待機時間に加える揺らぎの方式
+type Jitter int
+
+const (
+	// NoJitter 揺らぎを加えない(指数バックオフのみ)
+	NoJitter Jitter = iota
+	// FullJitter 0から指数バックオフの待機時間までの一様乱数とする
+	FullJitter
+	// DecorrelatedJitter 基準の待機時間から前回の待機時間の3倍までの一様乱数とする
+	DecorrelatedJitter
+)
+
+// RetryPolicy HTTPリクエストの再試行方針
+//
+// 既定では以下の場合に再試行します。
+//   - ネットワークエラー(呼び出し元のコンテキストが終了した場合を除く)
+//   - ステータスコード 408, 425, 429, 502, 503, 504 のレスポンス
+//
+// また既定では、べき等なメソッド(GET, HEAD, OPTIONS, TRACE, PUT, DELETE)、
+// およびべき等キー(Request.IdempotencyKey を参照)を付与したリクエストのみを再試行の対象とします。
+// Retry-Afterヘッダーを含むレスポンスに対しては、秒数・HTTP-dateのいずれの形式でもその指示に従って待機します。
+//
+// RetryPolicy は設定後に複数のリクエストから共有できます。
+type RetryPolicy struct {
+	maxAttempts        int
+	baseDelay          time.Duration
+	maxDelay           time.Duration
+	jitter             Jitter
+	attemptTimeout     time.Duration
+	retryNonIdempotent bool
+	retryIf            func(*http.Response, error) bool
+}
+
+// NewRetryPolicy RetryPolicyを生成する関数
+//
+// 既定値は最大3回の試行、基準の待機時間100ミリ秒、最大の待機時間10秒、FullJitter です。
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		maxAttempts: 3,
+		baseDelay:   100 * time.Millisecond,
+		maxDelay:    10 * time.Second,
+		jitter:      FullJitter,
+	}
+}
+
+// MaxAttempts 最初の試行を含む最大の試行回数を設定
+func (p *RetryPolicy) MaxAttempts(n int) *RetryPolicy {
+	p.maxAttempts = n
+	return p
+}
+
+// Backoff 指数バックオフの基準の待機時間と最大の待機時間を設定
+//
+// n回目の再試行の待機時間は base * 2^(n-1) を上限 max で打ち切ったものを基に、Jitter の方式で決定されます。
+func (p *RetryPolicy) Backoff(base, max time.Duration) *RetryPolicy {
+	p.baseDelay = base
+	p.maxDelay = max
+	return p
+}
+
+// Jitter 待機時間に加える揺らぎの方式を設定
+func (p *RetryPolicy) Jitter(j Jitter) *RetryPolicy {
+	p.jitter = j
+	return p
+}
+
+// AttemptTimeout 試行ごとのタイムアウトを設定
+//
+// 0の場合は呼び出し元のコンテキストのみに従います。
+func (p *RetryPolicy) AttemptTimeout(d time.Duration) *RetryPolicy {
+	p.attemptTimeout = d
+	return p
+}
+
+// RetryNonIdempotent べき等でないメソッド(POST, PATCH)も再試行の対象とするかを設定
+func (p *RetryPolicy) RetryNonIdempotent(retry bool) *RetryPolicy {
+	p.retryNonIdempotent = retry
+	return p
+}
+
+// RetryIf 再試行の要否を判定する関数を設定
+//
+// 既定の判定を置き換えます。resはネットワークエラーの場合nil、errはレスポンスを受け取った場合nilとなります。
+func (p *RetryPolicy) RetryIf(f func(res *http.Response, err error) bool) *RetryPolicy {
+	p.retryIf = f
+	return p
+}
+
+// attempts メソッドに対する最大の試行回数を返す
+//
+// keyedはべき等キー(Request.IdempotencyKey を参照)が付与されているかを表し、真の場合はメソッドによらず再試行の対象とします。
+func (p *RetryPolicy) attempts(method string, keyed bool) int {
+	if p == nil || p.maxAttempts < 1 {
+		return 1
+	}
+	if !p.retryNonIdempotent && !keyed && !isIdempotent(method) {
+		return 1
+	}
+	return p.maxAttempts
+}
+
+// shouldRetry 試行の結果から再試行の要否を判定
+func (p *RetryPolicy) shouldRetry(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		// 呼び出し元のコンテキストが終了している場合は再試行しない
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		// サーキットブレーカーにより遮断された場合は再試行しない
+		return false
+	}
+	if p.retryIf != nil {
+		return p.retryIf(res, err)
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return isRetryableStatus(res.StatusCode)
+}
+
+// delay n回目の再試行までの待機時間を返す
+//
+// prevは前回の待機時間です。Retry-Afterヘッダーが最大の待機時間を超える場合、第2返値はfalseとなります。
+func (p *RetryPolicy) delay(n int, prev time.Duration, res *http.Response) (time.Duration, bool) {
+	if res != nil {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+			return d, d <= p.maxDelay
+		}
+	}
+
+	base := max(p.baseDelay, 0)
+	backoff := base
+	for i := 1; i < n && backoff < p.maxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.maxDelay)
+
+	switch p.jitter {
+	case FullJitter:
+		return randDuration(0, backoff), true
+	case DecorrelatedJitter:
+		return min(randDuration(base, max(prev*3, base)), p.maxDelay), true
+	default:
+		return backoff, true
+	}
+}
+
+// randDuration [lo, hi] の一様乱数を返す
+func randDuration(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + rand.N(hi-lo+1)
+}
+
+// sleep コンテキストに従って待機
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// isIdempotent べき等なメソッド(RFC 9110 Section 9.2.2)であるかを返す
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,349 @@
+package httpc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+	"github.com/unvurn/httpc/codec"
+	"github.com/unvurn/httpc/form"
+)
+
+// newFlakyServer 最初のfailures回はstatusを返し、以降は受信したボディを返すサーバー
+func newFlakyServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var count atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if count.Add(1) <= failures {
+			for k, vv := range header {
+				w.Header()[k] = vv
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"body":` + string(b) + `}`))
+	}))
+	t.Cleanup(s.Close)
+	return s, &count
+}
+
+func fastRetry() *httpc.RetryPolicy {
+	return httpc.NewRetryPolicy().Backoff(time.Millisecond, 10*time.Millisecond)
+}
+
+func TestRequest_Retry(t *testing.T) {
+	s, count := newFlakyServer(t, 2, http.StatusServiceUnavailable, nil)
+
+	v, err := httpc.NewRequest[map[string]any]().Codec(codec.JSON()).Retry(fastRetry()).
+		Put(context.Background(), s.URL, map[string]int{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": float64(1)}, v["body"])
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestRequest_Retry_Exhausted(t *testing.T) {
+	s, count := newFlakyServer(t, 10, http.StatusBadGateway, nil)
+
+	_, err := httpc.NewRequest[[]byte]().Retry(fastRetry().MaxAttempts(4).Jitter(httpc.DecorrelatedJitter)).
+		Get(context.Background(), s.URL)
+	var e *httpc.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, http.StatusBadGateway, e.StatusCode())
+		assert.Equal(t, 4, e.Attempts())
+	}
+	assert.Equal(t, int32(4), count.Load())
+}
+
+func TestRequest_Retry_NonIdempotent(t *testing.T) {
+	s, count := newFlakyServer(t, 1, http.StatusServiceUnavailable, nil)
+
+	_, err := httpc.NewRequest[map[string]any]().Codec(codec.JSON()).Retry(fastRetry()).
+		Post(context.Background(), s.URL, map[string]int{"a": 1})
+	var e *httpc.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, 1, e.Attempts())
+	}
+	assert.Equal(t, int32(1), count.Load())
+
+	v, err := httpc.NewRequest[map[string]any]().Codec(codec.JSON()).Retry(fastRetry().RetryNonIdempotent(true)).
+		Post(context.Background(), s.URL, map[string]int{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": float64(1)}, v["body"])
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestRequest_Retry_RetryAfter(t *testing.T) {
+	s, count := newFlakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+
+	_, err := httpc.NewRequest[[]byte]().Retry(fastRetry()).Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), count.Load())
+
+	s, count = newFlakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}})
+	_, err = httpc.NewRequest[[]byte]().Retry(fastRetry()).Get(context.Background(), s.URL)
+	assert.ErrorIs(t, err, httpc.ErrRateLimited)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestRequest_Retry_AttemptTimeout(t *testing.T) {
+	var count atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	b, err := httpc.NewRequest[[]byte]().Retry(fastRetry().AttemptTimeout(50*time.Millisecond)).
+		Get(context.Background(), s.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(b))
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestRequest_Retry_NotRetryable(t *testing.T) {
+	s, count := newFlakyServer(t, 1, http.StatusNotFound, nil)
+
+	_, err := httpc.NewRequest[[]byte]().Retry(fastRetry()).Get(context.Background(), s.URL)
+	assert.ErrorIs(t, err, httpc.ErrNotFound)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestRequest_ReplayableBody_Redirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target", http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/target", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	b, err := httpc.NewRequest[[]byte]().Codec(codec.JSON()).Post(context.Background(), s.URL+"/redirect", map[string]int{"a": 1})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a":1}`, string(b))
+
+	b, err = httpc.NewRequest[[]byte]().PostForm(context.Background(), s.URL+"/redirect", params{Name: "a", Age: 1})
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "name=a")
+
+	b, err = httpc.NewRequest[[]byte]().PostForm(context.Background(), s.URL+"/redirect", params{Name: "a", Age: 1},
+		form.Bytes("file", "file.txt", []byte("content")))
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "content")
+
+	result, err := httpc.NewRequest[[]byte]().TryDoFunc(context.Background(), http.MethodPost, s.URL+"/redirect", "text/plain", func() (io.Reader, error) {
+		// 一度しか読み出せないReader
+		pr, pw := io.Pipe()
+		go func() {
+			_, _ = pw.Write([]byte("streamed"))
+			_ = pw.Close()
+		}()
+		return pr, nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, result.As(&b))
+	assert.Equal(t, "streamed", string(b))
+}
+
+// seekCounter Seekの呼び出しを数える io.ReadSeeker
+type seekCounter struct {
+	*strings.Reader
+	seeks int
+}
+
+func (s *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	s.seeks++
+	return s.Reader.Seek(offset, whence)
+}
+
+func TestRequest_ReplayableBody_Seeker(t *testing.T) {
+	var lengths []int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		lengths = append(lengths, r.ContentLength)
+		http.Redirect(w, r, "/target", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/target", func(w http.ResponseWriter, r *http.Request) {
+		lengths = append(lengths, r.ContentLength)
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	// io.ReadSeeker は複製せずに読み出し位置を戻して再送する
+	calls := 0
+	body := &seekCounter{Reader: strings.NewReader("xxseekable")}
+	_, _ = body.Reader.Seek(2, io.SeekStart)
+	result, err := httpc.NewRequest[[]byte]().TryDoFunc(context.Background(), http.MethodPost, s.URL+"/redirect", "text/plain", func() (io.Reader, error) {
+		calls++
+		return body, nil
+	})
+	assert.NoError(t, err)
+	var b []byte
+	assert.NoError(t, result.As(&b))
+	assert.Equal(t, "seekable", string(b))
+	assert.Equal(t, []int64{8, 8}, lengths)
+	assert.Equal(t, 1, calls)
+	assert.NotZero(t, body.seeks)
+}
+
+func TestRequest_ReplayableBody_Stream(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/target", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Header.Get("X-Body") + "|" + string(b)))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	pipe := func(content string) io.Reader {
+		pr, pw := io.Pipe()
+		go func() {
+			_, _ = pw.Write([]byte(content))
+			_ = pw.Close()
+		}()
+		return pr
+	}
+	post := func(r *httpc.Request[[]byte], path string, payloadFunc func() (io.Reader, error)) (string, error) {
+		result, err := r.TryDoFunc(context.Background(), http.MethodPost, s.URL+path, "text/plain", payloadFunc)
+		if err != nil {
+			return "", err
+		}
+		var b []byte
+		err = result.As(&b)
+		return string(b), err
+	}
+
+	// 再送しない場合、payloadFuncは1度だけ呼び出す
+	calls := 0
+	body, err := post(httpc.NewRequest[[]byte](), "/target", func() (io.Reader, error) {
+		calls++
+		return pipe("streamed"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "|streamed", body)
+	assert.Equal(t, 1, calls)
+
+	// 再送時にpayloadFuncがnilを返した場合は空のボディを送信する
+	calls = 0
+	body, err = post(httpc.NewRequest[[]byte](), "/redirect", func() (io.Reader, error) {
+		if calls++; calls > 1 {
+			return nil, nil
+		}
+		return pipe("streamed"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "|", body)
+	assert.Equal(t, 2, calls)
+
+	// 毎回同じ(一度しか読み出せない)readerを返す場合、送信前であれば読み込んで保持する
+	readBody := httpc.AuthFunc(func(req *http.Request) error {
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rc.Close() }()
+		b, err := io.ReadAll(rc)
+		req.Header.Set("X-Body", string(b))
+		return err
+	})
+	oneShot := pipe("one-shot")
+	body, err = post(httpc.NewRequest[[]byte]().Auth(readBody), "/redirect", func() (io.Reader, error) {
+		return oneShot, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "one-shot|one-shot", body)
+
+	// 送信済みの場合は再送できない
+	oneShot = pipe("one-shot")
+	_, err = post(httpc.NewRequest[[]byte](), "/redirect", func() (io.Reader, error) {
+		return oneShot, nil
+	})
+	assert.ErrorIs(t, err, httpc.ErrBodyNotReplayable)
+}
+
+func TestRequest_ReplayableBody_Retry(t *testing.T) {
+	s, count := newFlakyServer(t, 2, http.StatusServiceUnavailable, nil)
+
+	result, err := httpc.NewRequest[[]byte]().Retry(fastRetry().RetryNonIdempotent(true)).
+		TryDoFunc(context.Background(), http.MethodPost, s.URL, "application/json", func() (io.Reader, error) {
+			pr, pw := io.Pipe()
+			go func() {
+				_, _ = pw.Write([]byte(`"once"`))
+				_ = pw.Close()
+			}()
+			return pr, nil
+		})
+	assert.NoError(t, err)
+	var b []byte
+	assert.NoError(t, result.As(&b))
+	assert.JSONEq(t, `{"body":"once"}`, string(b))
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestRequest_IdempotencyKey(t *testing.T) {
+	var keys []string
+	var count atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key")+r.Header.Get("X-Request-Key"))
+		if count.Add(1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	result, err := httpc.NewRequest[[]byte]().Codec(codec.JSON()).IdempotencyKey(true).Retry(fastRetry()).
+		TryPost(context.Background(), s.URL, map[string]int{"amount": 100})
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, keys[0], keys[2])
+	assert.Equal(t, keys[0], result.(*httpc.HttpResult[[]byte]).IdempotencyKey())
+
+	keys = nil
+	_, err = httpc.NewRequest[[]byte]().Codec(codec.JSON()).
+		IdempotencyKeyHeader("X-Request-Key").
+		IdempotencyKeyFunc(func() string { return "fixed-key" }).
+		Post(context.Background(), s.URL, map[string]int{"amount": 100})
+	var e *httpc.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, "fixed-key", e.IdempotencyKey())
+		assert.Equal(t, 1, e.Attempts())
+	}
+	assert.Equal(t, []string{"fixed-key"}, keys)
+
+	keys = nil
+	_, err = httpc.NewRequest[[]byte]().IdempotencyKey(true).Get(context.Background(), s.URL)
+	assert.Equal(t, []string{""}, keys)
+}
+
+func TestNewIdempotencyKey(t *testing.T) {
+	k1, k2 := httpc.NewIdempotencyKey(), httpc.NewIdempotencyKey()
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, k1)
+	assert.NotEqual(t, k1, k2)
+}
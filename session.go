@@ -0,0 +1,494 @@
+package httpc
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Session リクエスト間でCookieを保持するセッション
+//
+// RFC 6265 に従ってCookieを保存・送信する [http.CookieJar] の実装です。
+// Domain属性はPublic Suffix Listを用いて検証し、"co.jp" のようなパブリックサフィックスに対するCookieは
+// 設定元のホストに限定(host-only)されるか、破棄されます。
+// Request.Session もしくは Client.Session に指定することで、リダイレクトを含む各リクエストでCookieを送受信します。
+//
+// SaveFile, LoadFile によりCookieをJSON形式のファイルに保存し、プロセスをまたいでセッションを継続できます。
+// Session は複数のgoroutineから安全に使用できます。
+type Session struct {
+	mu      sync.Mutex
+	entries map[string]map[string]cookieEntry // jarKey -> id -> entry
+	seq     uint64
+
+	now func() time.Time
+}
+
+// cookieEntry 保存されたCookie
+//
+// ファイルへの保存形式を兼ねます。
+type cookieEntry struct {
+	Name       string        `json:"name"`
+	Value      string        `json:"value"`
+	Quoted     bool          `json:"quoted,omitempty"`
+	Domain     string        `json:"domain"`
+	Path       string        `json:"path"`
+	SameSite   http.SameSite `json:"same_site,omitempty"`
+	Secure     bool          `json:"secure,omitempty"`
+	HttpOnly   bool          `json:"http_only,omitempty"`
+	HostOnly   bool          `json:"host_only,omitempty"`
+	Persistent bool          `json:"persistent,omitempty"`
+	Expires    time.Time     `json:"expires"`
+	Creation   time.Time     `json:"creation"`
+	LastAccess time.Time     `json:"last_access"`
+
+	// seq 作成日時が同一のCookieの順序を決めるための連番
+	seq uint64
+}
+
+// endOfTime 有効期限のないCookie(セッションCookie)に設定する有効期限
+var endOfTime = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// NewSession Sessionを生成する関数
+func NewSession() *Session {
+	return &Session{
+		entries: map[string]map[string]cookieEntry{},
+		now:     time.Now,
+	}
+}
+
+// id Cookieを一意に識別する文字列を返す
+func (e *cookieEntry) id() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+// cookie 保存されたCookieを [http.Cookie] として返す
+func (e *cookieEntry) cookie() *http.Cookie {
+	c := &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Quoted:   e.Quoted,
+		Domain:   e.Domain,
+		Path:     e.Path,
+		SameSite: e.SameSite,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+	}
+	if e.Persistent {
+		c.Expires = e.Expires
+	}
+	return c
+}
+
+// shouldSend Cookieを指定したホスト・パスへのリクエストで送信するかを返す
+func (e *cookieEntry) shouldSend(https bool, host, path string) bool {
+	return e.domainMatch(host) && e.pathMatch(path) && (https || !e.Secure)
+}
+
+// domainMatch RFC 6265 Section 5.1.3 のドメインの一致
+func (e *cookieEntry) domainMatch(host string) bool {
+	if e.Domain == host {
+		return true
+	}
+	return !e.HostOnly && hasDotSuffix(host, e.Domain)
+}
+
+// pathMatch RFC 6265 Section 5.1.4 のパスの一致
+func (e *cookieEntry) pathMatch(path string) bool {
+	if path == e.Path {
+		return true
+	}
+	if strings.HasPrefix(path, e.Path) {
+		return e.Path[len(e.Path)-1] == '/' || path[len(e.Path)] == '/'
+	}
+	return false
+}
+
+// Cookies URLへのリクエストで送信するCookieを返す([http.CookieJar] の実装)
+//
+// パスの長いものから、作成日時の古いものから順に並べて返します。
+func (s *Session) Cookies(u *url.URL) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return nil
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := jarKey(host)
+	submap := s.entries[key]
+	if submap == nil {
+		return nil
+	}
+
+	now := s.now()
+	var selected []cookieEntry
+	for id, e := range submap {
+		if e.Persistent && !e.Expires.After(now) {
+			delete(submap, id)
+			continue
+		}
+		if !e.shouldSend(u.Scheme == "https", host, path) {
+			continue
+		}
+		e.LastAccess = now
+		submap[id] = e
+		selected = append(selected, e)
+	}
+	if len(submap) == 0 {
+		delete(s.entries, key)
+	}
+
+	slices.SortFunc(selected, func(a, b cookieEntry) int {
+		if c := cmp.Compare(len(b.Path), len(a.Path)); c != 0 {
+			return c
+		}
+		if c := a.Creation.Compare(b.Creation); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	cookies := make([]*http.Cookie, len(selected))
+	for i, e := range selected {
+		cookies[i] = &http.Cookie{Name: e.Name, Value: e.Value, Quoted: e.Quoted}
+	}
+	return cookies
+}
+
+// SetCookies URLへのリクエストに対するレスポンスで受け取ったCookieを保存([http.CookieJar] の実装)
+//
+// Domain属性が不正なCookieは破棄します。Max-Ageが負、もしくは有効期限を過ぎたCookieは既存のCookieを削除します。
+func (s *Session) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if len(cookies) == 0 || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		return
+	}
+	defPath := defaultPath(u.Path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := jarKey(host)
+	submap := s.entries[key]
+	now := s.now()
+	for _, c := range cookies {
+		e, remove, err := newCookieEntry(c, now, defPath, host)
+		if err != nil {
+			continue
+		}
+		id := e.id()
+		if remove {
+			delete(submap, id)
+			continue
+		}
+		if submap == nil {
+			submap = map[string]cookieEntry{}
+		}
+		if old, ok := submap[id]; ok {
+			e.Creation = old.Creation
+			e.seq = old.seq
+		} else {
+			e.seq = s.seq
+			s.seq++
+		}
+		e.LastAccess = now
+		submap[id] = e
+	}
+
+	if len(submap) == 0 {
+		delete(s.entries, key)
+	} else {
+		s.entries[key] = submap
+	}
+}
+
+// AllCookies 保存されているすべてのCookieを返す
+//
+// 有効期限を過ぎたCookieは含みません。返されるCookieのDomain属性には保存先のドメイン(host-onlyのCookieでは設定元のホスト)、
+// Expires属性にはセッションCookieを除き有効期限を設定し、ドメイン、パス、名前の順に並べて返します。
+func (s *Session) AllCookies() []*http.Cookie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.live()
+	cookies := make([]*http.Cookie, len(entries))
+	for i, e := range entries {
+		cookies[i] = e.cookie()
+	}
+	return cookies
+}
+
+// Clear 保存されているすべてのCookieを削除
+func (s *Session) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = map[string]map[string]cookieEntry{}
+}
+
+// ClearDomain ドメイン(およびそのサブドメイン)のCookieを削除
+func (s *Session) ClearDomain(domain string) {
+	domain, err := canonicalHost(domain)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, submap := range s.entries {
+		for id, e := range submap {
+			if e.Domain == domain || hasDotSuffix(e.Domain, domain) {
+				delete(submap, id)
+			}
+		}
+		if len(submap) == 0 {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// Save 保存されているCookieをJSON形式で書き出す
+//
+// 有効期限を過ぎたCookieを除き、セッションCookieを含むすべてのCookieを書き出します。
+func (s *Session) Save(w io.Writer) error {
+	s.mu.Lock()
+	entries := s.live()
+	s.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// Load Save で書き出したCookieを読み込む
+//
+// 読み込んだCookieは既存のCookieに追加(同一のドメイン、パス、名前のCookieは上書き)されます。
+// 有効期限を過ぎたCookieは読み込みません。
+func (s *Session) Load(r io.Reader) error {
+	var entries []cookieEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for _, e := range entries {
+		if e.Name == "" || e.Domain == "" || !strings.HasPrefix(e.Path, "/") {
+			continue
+		}
+		if e.Persistent && !e.Expires.After(now) {
+			continue
+		}
+		if !e.Persistent {
+			e.Expires = endOfTime
+		}
+		key := jarKey(e.Domain)
+		if s.entries[key] == nil {
+			s.entries[key] = map[string]cookieEntry{}
+		}
+		e.seq = s.seq
+		s.seq++
+		s.entries[key][e.id()] = e
+	}
+	return nil
+}
+
+// SaveFile 保存されているCookieをJSON形式でファイルに書き出す
+//
+// 一時ファイルに書き出した後に置き換えるため、書き出しに失敗しても既存のファイルは損なわれません。
+// Cookieには認証情報が含まれるため、ファイルのパーミッションは0600とします。
+func (s *Session) SaveFile(name string) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if err := s.Save(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// LoadFile SaveFile で書き出したファイルからCookieを読み込む
+//
+// ファイルが存在しない場合は何もせずnilを返します。
+func (s *Session) LoadFile(name string) error {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return s.Load(f)
+}
+
+// live 有効期限内のCookieをドメイン、パス、名前の順に並べて返す
+func (s *Session) live() []cookieEntry {
+	now := s.now()
+	var entries []cookieEntry
+	for _, submap := range s.entries {
+		for _, e := range submap {
+			if e.Persistent && !e.Expires.After(now) {
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b cookieEntry) int {
+		return cmp.Or(
+			strings.Compare(a.Domain, b.Domain),
+			strings.Compare(a.Path, b.Path),
+			strings.Compare(a.Name, b.Name),
+		)
+	})
+	return entries
+}
+
+var (
+	errIllegalDomain   = errors.New("httpc: illegal cookie domain attribute")
+	errMalformedDomain = errors.New("httpc: malformed cookie domain attribute")
+)
+
+// newCookieEntry レスポンスのCookieから保存するCookieを生成
+//
+// removeがtrueの場合は、同一のCookieを削除することを表します。
+func newCookieEntry(c *http.Cookie, now time.Time, defPath, host string) (e cookieEntry, remove bool, err error) {
+	e.Name = c.Name
+	if c.Path == "" || c.Path[0] != '/' {
+		e.Path = defPath
+	} else {
+		e.Path = c.Path
+	}
+
+	e.Domain, e.HostOnly, err = domainAndType(host, c.Domain)
+	if err != nil {
+		return e, false, err
+	}
+
+	// RFC 6265 Section 5.2.2: Max-AgeはExpiresに優先する
+	switch {
+	case c.MaxAge < 0:
+		return e, true, nil
+	case c.MaxAge > 0:
+		e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		e.Persistent = true
+	case c.Expires.IsZero():
+		e.Expires = endOfTime
+	case !c.Expires.After(now):
+		return e, true, nil
+	default:
+		e.Expires = c.Expires
+		e.Persistent = true
+	}
+
+	e.Value = c.Value
+	e.Quoted = c.Quoted
+	e.Secure = c.Secure
+	e.HttpOnly = c.HttpOnly
+	e.SameSite = c.SameSite
+	e.Creation = now
+	return e, false, nil
+}
+
+// domainAndType Domain属性からCookieのドメインと、host-onlyであるかを返す(RFC 6265 Section 5.3)
+func domainAndType(host, domain string) (string, bool, error) {
+	if domain == "" {
+		return host, true, nil
+	}
+
+	if net.ParseIP(host) != nil {
+		// IPアドレスに対してはDomain属性がホストと一致する場合のみ許可する
+		if host != strings.TrimPrefix(domain, ".") {
+			return "", false, errIllegalDomain
+		}
+		return host, true, nil
+	}
+
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if domain == "" || domain[0] == '.' || domain[len(domain)-1] == '.' {
+		return "", false, errMalformedDomain
+	}
+
+	// パブリックサフィックスに対するCookieは、設定元のホストと一致する場合のみhost-onlyとして許可する
+	if ps, _ := publicsuffix.PublicSuffix(domain); ps == domain {
+		if host == domain {
+			return host, true, nil
+		}
+		return "", false, errIllegalDomain
+	}
+
+	if host != domain && !hasDotSuffix(host, domain) {
+		return "", false, errIllegalDomain
+	}
+	return domain, false, nil
+}
+
+// jarKey ホストに対するCookieの格納先のキー(登録可能なドメイン)を返す
+func jarKey(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	key, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return key
+}
+
+// canonicalHost ポートを除き小文字化したホスト名を返す
+func canonicalHost(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", errMalformedDomain
+	}
+	return host, nil
+}
+
+// defaultPath RFC 6265 Section 5.1.4 の既定のパス
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// hasDotSuffix sがsuffixのサブドメインであるかを返す
+func hasDotSuffix(s, suffix string) bool {
+	return len(s) > len(suffix) && s[len(s)-len(suffix)-1] == '.' && s[len(s)-len(suffix):] == suffix
+}
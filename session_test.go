@@ -0,0 +1,137 @@
+package httpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/unvurn/httpc"
+)
+
+func cookieNames(cookies []*http.Cookie) []string {
+	names := make([]string, len(cookies))
+	for i, c := range cookies {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func TestSession_SetCookies(t *testing.T) {
+	s := httpc.NewSession()
+	u, _ := url.Parse("https://www.example.co.uk/app/login")
+	s.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.co.uk", Path: "/"},
+		{Name: "suffix", Value: "3", Domain: "co.uk"},
+		{Name: "other", Value: "4", Domain: "example.com"},
+		{Name: "secure", Value: "5", Path: "/app/login", Secure: true},
+	})
+
+	get := func(raw string) []string {
+		u, _ := url.Parse(raw)
+		return cookieNames(s.Cookies(u))
+	}
+	// パスの長いものから順に返す
+	assert.Equal(t, []string{"secure", "host", "domain"}, get("https://www.example.co.uk/app/login"))
+	assert.Equal(t, []string{"host", "domain"}, get("http://www.example.co.uk/app/login"))
+	assert.Equal(t, []string{"domain"}, get("https://api.example.co.uk/app"))
+	assert.Empty(t, get("https://example.com/"))
+	assert.Equal(t, []string{"domain"}, get("https://www.example.co.uk/application"))
+
+	all := s.AllCookies()
+	assert.Equal(t, []string{"domain", "host", "secure"}, cookieNames(all))
+	assert.Equal(t, "example.co.uk", all[0].Domain)
+	assert.Equal(t, "www.example.co.uk", all[1].Domain)
+	assert.Equal(t, "/app", all[1].Path)
+
+	// Max-Ageが負のCookieは既存のCookieを削除する
+	s.SetCookies(u, []*http.Cookie{{Name: "host", MaxAge: -1}})
+	assert.Equal(t, []string{"domain", "secure"}, cookieNames(s.AllCookies()))
+
+	s.ClearDomain("www.example.co.uk")
+	assert.Equal(t, []string{"domain"}, cookieNames(s.AllCookies()))
+	s.Clear()
+	assert.Empty(t, s.AllCookies())
+}
+
+func TestSession_Expires(t *testing.T) {
+	s := httpc.NewSession()
+	u, _ := url.Parse("https://example.com/")
+	s.SetCookies(u, []*http.Cookie{
+		{Name: "expired", Value: "1", Expires: time.Now().Add(-time.Hour)},
+		{Name: "persistent", Value: "2", Expires: time.Now().Add(time.Hour)},
+		{Name: "max-age", Value: "3", MaxAge: 3600, Expires: time.Now().Add(-time.Hour)},
+	})
+	all := s.AllCookies()
+	assert.Equal(t, []string{"max-age", "persistent"}, cookieNames(all))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), all[0].Expires, time.Minute)
+}
+
+func TestSession_SaveFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cookies.json")
+
+	s := httpc.NewSession()
+	assert.NoError(t, s.LoadFile(name))
+	u, _ := url.Parse("https://example.com/")
+	s.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "abc", HttpOnly: true},
+		{Name: "pref", Value: "dark", Domain: "example.com", Path: "/", Expires: time.Now().Add(time.Hour)},
+	})
+	assert.NoError(t, s.SaveFile(name))
+
+	loaded := httpc.NewSession()
+	assert.NoError(t, loaded.LoadFile(name))
+	want, got := s.AllCookies(), loaded.AllCookies()
+	assert.Equal(t, cookieNames(want), cookieNames(got))
+	for i := range want {
+		assert.Equal(t, want[i].Value, got[i].Value)
+		assert.Equal(t, want[i].HttpOnly, got[i].HttpOnly)
+		assert.True(t, want[i].Expires.Equal(got[i].Expires))
+	}
+
+	sub, _ := url.Parse("https://www.example.com/")
+	assert.Equal(t, []string{"pref"}, cookieNames(loaded.Cookies(sub)))
+	assert.ElementsMatch(t, []string{"session", "pref"}, cookieNames(loaded.Cookies(u)))
+}
+
+func TestClient_Session(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s3cr3t", Path: "/"})
+			http.Redirect(w, r, "/me", http.StatusFound)
+		case "/me":
+			c, err := r.Cookie("sid")
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(c.Value))
+		}
+	}))
+	defer s.Close()
+
+	session := httpc.NewSession()
+	c := httpc.NewClient().BaseURL(s.URL).Session(session)
+
+	// リダイレクト先にもCookieを送信する
+	res, err := httpc.NewRequestFrom[[]byte](c).TryGet(context.Background(), "/login")
+	assert.NoError(t, err)
+	var v []byte
+	assert.NoError(t, res.As(&v))
+	assert.Equal(t, "s3cr3t", string(v))
+	assert.Equal(t, []string{"sid"}, cookieNames(session.AllCookies()))
+
+	_, err = httpc.NewRequestFrom[[]byte](c).TryGet(context.Background(), "/me")
+	assert.NoError(t, err)
+
+	session.Clear()
+	_, err = httpc.NewRequestFrom[[]byte](c).TryGet(context.Background(), "/me")
+	assert.ErrorIs(t, err, httpc.ErrUnauthorized)
+}
@@ -0,0 +1,89 @@
+package sigv4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"time"
+)
+
+// chunkSignatureLength チャンク拡張 ";chunk-signature=" と署名(16進64文字)の長さ
+const chunkSignatureLength = len(";chunk-signature=") + 64
+
+// encodedLength aws-chunked エンコーディング後のボディの長さを返す
+func encodedLength(decoded int64, chunkSize int) int64 {
+	size := int64(chunkSize)
+	chunk := func(n int64) int64 {
+		return int64(len(strconv.FormatInt(n, 16))+chunkSignatureLength+2) + n + 2
+	}
+	total := (decoded / size) * chunk(size)
+	if rest := decoded % size; rest > 0 {
+		total += chunk(rest)
+	}
+	return total + chunk(0)
+}
+
+// chunkedReader ボディをチャンクに分割し、各チャンクに署名を付与して aws-chunked エンコーディングで読み出すReader
+//
+// 各チャンクの署名は前のチャンクの署名(最初のチャンクはリクエストの署名)から連鎖して算出し、
+// 最後に長さ0のチャンクを付与します。
+type chunkedReader struct {
+	body      io.ReadCloser
+	chunkSize int
+	key       []byte
+	timestamp string
+	scope     string
+	prev      string
+
+	buf  bytes.Buffer
+	done bool
+}
+
+func newChunkedReader(body io.ReadCloser, chunkSize int, key []byte, t time.Time, scope, seed string) *chunkedReader {
+	return &chunkedReader{
+		body:      body,
+		chunkSize: chunkSize,
+		key:       key,
+		timestamp: t.Format(timeFormat),
+		scope:     scope,
+		prev:      seed,
+	}
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		chunk := make([]byte, r.chunkSize)
+		n, err := io.ReadFull(r.body, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		if n > 0 {
+			r.writeChunk(chunk[:n])
+		}
+		if n < r.chunkSize {
+			r.writeChunk(nil)
+			r.done = true
+		}
+	}
+	return r.buf.Read(p)
+}
+
+func (r *chunkedReader) Close() error {
+	return r.body.Close()
+}
+
+// writeChunk チャンクに署名を付与してバッファに書き込む
+func (r *chunkedReader) writeChunk(data []byte) {
+	stringToSign := "AWS4-HMAC-SHA256-PAYLOAD\n" + r.timestamp + "\n" + r.scope + "\n" +
+		r.prev + "\n" + emptyPayloadHash + "\n" + hexSHA256(data)
+	signature := hex.EncodeToString(hmacSHA256(r.key, stringToSign))
+	r.prev = signature
+
+	r.buf.WriteString(strconv.FormatInt(int64(len(data)), 16) + ";chunk-signature=" + signature + "\r\n")
+	r.buf.Write(data)
+	r.buf.WriteString("\r\n")
+}
@@ -0,0 +1,401 @@
+// Package sigv4 AWS Signature Version 4 によるリクエストの署名
+//
+// Signer は httpc.Auth を実装しており、Request.Auth もしくは Client.Auth に指定することで
+// 各リクエストに署名を付与します。S3互換のオブジェクトストレージ向けに、UNSIGNED-PAYLOAD、
+// チャンク単位の署名(STREAMING-AWS4-HMAC-SHA256-PAYLOAD)、署名付きURLの生成にも対応します。
+//
+//	signer := sigv4.NewSigner("AKID", "SECRET", "us-east-1", "s3")
+//	c := httpc.NewClient().BaseURL("http://localhost:9000").Auth(signer)
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm  = "AWS4-HMAC-SHA256"
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+
+	// UnsignedPayload ペイロードを署名に含めない場合のペイロードハッシュ
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+	// StreamingPayload チャンク単位で署名する場合のペイロードハッシュ
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+	// emptyPayloadHash 空のペイロードのSHA-256
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var ErrBodyNotReplayable = errors.New("sigv4: request body must be replayable to compute payload hash")
+
+// ignoredHeaders 署名に含めないヘッダー
+//
+// 送信経路で付与・変更されうるヘッダーを除外します。
+var ignoredHeaders = []string{
+	"authorization",
+	"user-agent",
+	"x-amzn-trace-id",
+	"expect",
+	"connection",
+	"transfer-encoding",
+}
+
+// Signer AWS Signature Version 4 によりリクエストに署名するAuth
+//
+// 署名にはメソッド、正規化したURIとクエリパラメータ、ヘッダー(Host, X-Amz-* を含む)、ペイロードのハッシュを用います。
+// ペイロードは http.Request.GetBody により再取得するため、送信するボディには影響しません。
+// Signer は設定後に複数のgoroutineから共有できます。
+type Signer struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	region          string
+	service         string
+
+	unsignedPayload bool
+	chunkSize       int
+	contentSHA256   bool
+}
+
+// NewSigner Signerを生成する関数
+//
+// serviceが "s3" の場合は、S3の規則(パスの二重エンコードを行わない、X-Amz-Content-Sha256ヘッダーを付与する)に従います。
+func NewSigner(accessKeyID, secretAccessKey, region, service string) *Signer {
+	return &Signer{
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		region:          region,
+		service:         service,
+		contentSHA256:   service == "s3",
+	}
+}
+
+// SessionToken 一時的な認証情報のセッショントークンを設定
+func (s *Signer) SessionToken(token string) *Signer {
+	s.sessionToken = token
+	return s
+}
+
+// UnsignedPayload ペイロードを署名に含めない(UNSIGNED-PAYLOAD)かを設定
+//
+// 大きなボディのハッシュ計算を省略できます。HTTPSでの使用を前提とします。
+func (s *Signer) UnsignedPayload(unsigned bool) *Signer {
+	s.unsignedPayload = unsigned
+	return s
+}
+
+// StreamingChunkSize チャンク単位の署名(STREAMING-AWS4-HMAC-SHA256-PAYLOAD)を有効にし、チャンクの大きさを設定
+//
+// ボディを持つリクエストは aws-chunked エンコーディングで送信され、各チャンクに前のチャンクから連鎖した署名が付与されます。
+// 0を指定すると無効になります。S3は8KiB以上のチャンクを要求します。
+func (s *Signer) StreamingChunkSize(n int) *Signer {
+	s.chunkSize = n
+	return s
+}
+
+// ContentSHA256Header X-Amz-Content-Sha256ヘッダーを付与するかを設定
+//
+// 既定ではserviceが "s3" の場合に付与します。UNSIGNED-PAYLOAD およびチャンク単位の署名では常に付与します。
+func (s *Signer) ContentSHA256Header(enabled bool) *Signer {
+	s.contentSHA256 = enabled
+	return s
+}
+
+// Apply 現在時刻によりリクエストに署名する(httpc.Auth の実装)
+func (s *Signer) Apply(req *http.Request) error {
+	return s.Sign(req, time.Now())
+}
+
+// Sign 指定した時刻によりリクエストに署名する
+//
+// X-Amz-Date, X-Amz-Security-Token 等のヘッダーと Authorization ヘッダーを設定します。
+func (s *Signer) Sign(req *http.Request, t time.Time) error {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(timeFormat))
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	streaming := s.chunkSize > 0 && req.ContentLength != 0 && req.Body != nil && req.Body != http.NoBody
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	switch {
+	case payloadHash != "":
+	case streaming:
+		payloadHash = StreamingPayload
+	case s.unsignedPayload:
+		payloadHash = UnsignedPayload
+	default:
+		h, err := hashBody(req)
+		if err != nil {
+			return err
+		}
+		payloadHash = h
+	}
+	if s.contentSHA256 || payloadHash == UnsignedPayload || payloadHash == StreamingPayload {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	var decodedLength int64
+	if streaming {
+		if req.ContentLength < 0 {
+			return errors.New("sigv4: streaming signature requires a known content length")
+		}
+		decodedLength = req.ContentLength
+		req.Header.Set("Content-Encoding", appendEncoding(req.Header.Get("Content-Encoding")))
+		req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(decodedLength, 10))
+		req.ContentLength = encodedLength(decodedLength, s.chunkSize)
+	}
+
+	canonicalURI := s.canonicalURI(req.URL)
+	req.URL.RawPath = s.escapedPath(req.URL)
+	signedHeaders, canonicalHeaders := canonicalHeaders(req, streaming)
+	creq := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := s.scope(t)
+	signature := s.signature(t, scope, creq)
+	req.Header.Set("Authorization", algorithm+" Credential="+s.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+
+	if streaming {
+		key := s.signingKey(t)
+		body := req.Body
+		req.Body = newChunkedReader(body, s.chunkSize, key, t, scope, signature)
+		if getBody := req.GetBody; getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				b, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return newChunkedReader(b, s.chunkSize, key, t, scope, signature), nil
+			}
+		}
+	}
+	return nil
+}
+
+// Presign 指定した時刻と有効期間により署名付きURLを生成する
+//
+// 署名はクエリパラメータ(X-Amz-Signature 等)として付与され、ヘッダーはHostおよびリクエストに設定済みのものが署名の対象となります。
+// ペイロードは署名に含めません(UNSIGNED-PAYLOAD)。reqは変更されません。
+func (s *Signer) Presign(req *http.Request, expires time.Duration, t time.Time) (string, error) {
+	t = t.UTC()
+	u := *req.URL
+	scope := s.scope(t)
+
+	r := req.Clone(req.Context())
+	r.URL = &u
+	r.Header.Del("Authorization")
+	signedHeaders, canonicalHeaders := canonicalHeaders(r, false)
+
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", s.accessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", t.Format(timeFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", signedHeaders)
+	if s.sessionToken != "" {
+		q.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	creq := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(&u),
+		canonicalQuery(q),
+		canonicalHeaders,
+		signedHeaders,
+		UnsignedPayload,
+	}, "\n")
+	q.Set("X-Amz-Signature", s.signature(t, scope, creq))
+
+	u.RawPath = s.escapedPath(&u)
+	u.RawQuery = canonicalQuery(q)
+	return u.String(), nil
+}
+
+// scope 資格情報のスコープ("date/region/service/aws4_request")を返す
+func (s *Signer) scope(t time.Time) string {
+	return t.Format(dateFormat) + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+// signature 正規リクエストに対する署名を返す
+func (s *Signer) signature(t time.Time, scope, canonicalRequest string) string {
+	stringToSign := algorithm + "\n" + t.Format(timeFormat) + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+	return hex.EncodeToString(hmacSHA256(s.signingKey(t), stringToSign))
+}
+
+// signingKey 署名鍵を導出
+func (s *Signer) signingKey(t time.Time) []byte {
+	k := hmacSHA256([]byte("AWS4"+s.secretAccessKey), t.Format(dateFormat))
+	k = hmacSHA256(k, s.region)
+	k = hmacSHA256(k, s.service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+// escapedPath 送信するパス(各セグメントを1度エンコード)を返す
+//
+// セグメントはエンコード済みのパスから分割するため、セグメント内のエンコードされたスラッシュ(%2F)は区切りとみなしません。
+func (s *Signer) escapedPath(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, seg := range segments {
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			seg = unescaped
+		}
+		segments[i] = escape(seg)
+	}
+	p := strings.Join(segments, "/")
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+// canonicalURI 正規URIを返す
+//
+// S3以外のサービスでは、各セグメントを2度エンコードします。
+func (s *Signer) canonicalURI(u *url.URL) string {
+	p := s.escapedPath(u)
+	if s.service == "s3" {
+		return p
+	}
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery 正規クエリ文字列を返す
+//
+// パラメータはエンコードしたキー、次にエンコードした値の順に並べます。
+// 連結した文字列で並べると、"key" と "key-marker" のように一方が他方の前方に一致するキーの順序が変わるためです。
+func canonicalQuery(q url.Values) string {
+	type pair struct{ k, v string }
+	pairs := make([]pair, 0, len(q))
+	for k, vv := range q {
+		for _, v := range vv {
+			pairs = append(pairs, pair{escape(k), escape(v)})
+		}
+	}
+	slices.SortFunc(pairs, func(a, b pair) int {
+		if c := strings.Compare(a.k, b.k); c != 0 {
+			return c
+		}
+		return strings.Compare(a.v, b.v)
+	})
+	joined := make([]string, len(pairs))
+	for i, p := range pairs {
+		joined[i] = p.k + "=" + p.v
+	}
+	return strings.Join(joined, "&")
+}
+
+// canonicalHeaders 署名するヘッダーの一覧と正規ヘッダーを返す
+//
+// withContentLength が真の場合はContent-Lengthを含めます(チャンク単位の署名)。
+func canonicalHeaders(req *http.Request, withContentLength bool) (string, string) {
+	values := map[string][]string{}
+	for k, vv := range req.Header {
+		name := strings.ToLower(k)
+		if slices.Contains(ignoredHeaders, name) {
+			continue
+		}
+		values[name] = append(values[name], vv...)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values["host"] = []string{host}
+	if withContentLength {
+		values["content-length"] = []string{strconv.FormatInt(req.ContentLength, 10)}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		vv := make([]string, len(values[name]))
+		for i, v := range values[name] {
+			vv[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(name + ":" + strings.Join(vv, ",") + "\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+// hashBody ボディのSHA-256を返す
+func hashBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return emptyPayloadHash, nil
+	}
+	if req.GetBody == nil {
+		return "", ErrBodyNotReplayable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = body.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// appendEncoding Content-Encodingに aws-chunked を加える
+func appendEncoding(encoding string) string {
+	if encoding == "" {
+		return "aws-chunked"
+	}
+	if strings.Contains(encoding, "aws-chunked") {
+		return encoding
+	}
+	return "aws-chunked," + encoding
+}
+
+// escape RFC 3986 の非予約文字以外をパーセントエンコード
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,56 @@
+package httpc
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// statusKey ステータスコードのパターンを正規化
+//
+// "404" のような個別のステータスコード、もしくは "4xx" のようなステータスクラスを受け付けます。
+// いずれにも該当しない文字列が指定された場合はpanicします。
+func statusKey(status string) string {
+	s := strings.ToLower(strings.TrimSpace(status))
+	if len(s) == 3 && s[0] >= '1' && s[0] <= '5' {
+		if s[1:] == "xx" {
+			return s
+		}
+		if _, err := strconv.Atoi(s); err == nil {
+			return s
+		}
+	}
+	panic("invalid status pattern: " + status)
+}
+
+// statusKeys ステータスコードに一致するパターンを優先順に返す
+func statusKeys(code int) []string {
+	return []string{strconv.Itoa(code), strconv.Itoa(code/100) + "xx"}
+}
+
+// negotiateStatus ステータスコードとメディアタイプに最も適合する値を返す
+//
+// 個別のステータスコードに対する登録を、ステータスクラスに対する登録より優先します。
+// 各々の中ではメディアレンジによる選択(mediaEntries.negotiate)を行います。
+// 第2返値は一致の度合いで、一致するものがない場合は matchNone となります。
+func negotiateStatus[V any](m map[string]mediaEntries[V], code int, mt MediaType) (V, int) {
+	for _, key := range statusKeys(code) {
+		if v, _, level := m[key].negotiate(mt); level != matchNone {
+			return v, level
+		}
+	}
+	var zero V
+	return zero, matchNone
+}
+
+// cloneStatusEntries ステータスコードごとの登録を複製
+func cloneStatusEntries[V any](m map[string]mediaEntries[V]) map[string]mediaEntries[V] {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]mediaEntries[V], len(m))
+	for k, es := range m {
+		c[k] = slices.Clone(es)
+	}
+	return c
+}